@@ -46,7 +46,8 @@ class AuthService {
         // After signup, we need to login to get the session cookie
         return await loginWithPassword(email: email, password: password);
       } else {
-        final errorMessage = response.data['error'] ?? response.data.toString();
+        final errorMessage =
+            _problemDetail(response.data) ?? response.data.toString();
         throw AuthException(
           response.statusCode ?? 500,
           'Signup failed: $errorMessage',
@@ -56,8 +57,13 @@ class AuthService {
       if (e.response?.statusCode == 409) {
         throw AuthException(409, 'An account with this email already exists');
       } else if (e.response?.statusCode == 400) {
-        final errorMessage = e.response?.data?.toString() ?? 'Invalid request';
+        final errorMessage =
+            _problemDetail(e.response?.data) ?? 'Invalid request';
         throw AuthException(400, errorMessage);
+      } else if (e.response?.statusCode == 403) {
+        final errorMessage =
+            _problemDetail(e.response?.data) ?? 'Signups are not allowed';
+        throw AuthException(403, errorMessage);
       } else {
         throw AuthException(
           503,
@@ -160,4 +166,12 @@ class AuthService {
       await HttpClient.instance.clearCookies();
     }
   }
+
+  // Reads the human readable message from a problem details (RFC 9457) body
+  String? _problemDetail(dynamic data) {
+    if (data is Map) {
+      return (data['detail'] ?? data['error'])?.toString();
+    }
+    return null;
+  }
 }
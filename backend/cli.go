@@ -0,0 +1,874 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/handlers"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/module"
+	"github.com/anish-chanda/go-app-starter/migrations"
+)
+
+const (
+	cliTimeout         = 30 * time.Second
+	healthcheckTimeout = 3 * time.Second
+	// maxNameLen matches the max of SignupRequest.Name
+	maxNameLen = 255
+)
+
+const usage = `Usage: api [command]
+
+Commands:
+  serve                                   run the API, the default without a command
+  migrate up [-dry-run]                   apply pending migrations of the core and every module
+  migrate down [-n 1 | -all] [-source core] [-dry-run]
+                                          roll back the last n migrations of a source
+  migrate goto [-source core] [-dry-run] VERSION
+                                          apply or roll back migrations until VERSION
+  migrate status [-source NAME]           list the applied and pending migrations
+  migrate force -source core VERSION      set the version after fixing a failed migration by hand
+  migrate create [-dir DIR] NAME          add an empty core migration
+  user create -email EMAIL [-name NAME] [-admin]
+  user set-password -email EMAIL          the password is read from stdin
+  user grant-admin -email EMAIL [-revoke]
+  user invite -email EMAIL [-ttl 168h]    invite an address to sign up when SIGNUP_MODE=invite
+  config check                            validate the configuration and build the app
+  config print                            print the configuration with secrets redacted
+  healthcheck [-live] [-url URL]          probe the running server, for Docker HEALTHCHECK
+  routes                                  list the registered route patterns
+
+Every command reads the same environment variables as serve.
+`
+
+// errUsage is returned for bad arguments, usage was already printed
+var errUsage = errors.New("invalid usage")
+
+// cli runs the subcommands, the streams are fields so tests can capture them
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func runCLI(args []string) int {
+	c := cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	return c.run(args)
+}
+
+func (c cli) run(args []string) int {
+	cmd := "serve"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = c.serve(args)
+	case "migrate":
+		err = c.migrate(args)
+	case "user":
+		err = c.user(args)
+	case "config":
+		err = c.config(args)
+	case "healthcheck":
+		err = c.healthcheck(args)
+	case "routes":
+		err = c.routes(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+
+	switch {
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case err != nil:
+		fmt.Fprintf(c.stderr, "%s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// loadConfig reads the environment and sets up logging. Only serve logs to stdout, the other
+// commands keep it free for their output.
+func (c cli) loadConfig(logToStdout bool) (*cfg.Config, error) {
+	config, err := cfg.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if !logToStdout && config.Log.Out == os.Stdout {
+		config.Log.Out = c.stderr
+	}
+	logger.Init(config.Log)
+	return config, nil
+}
+
+// flags creates a flag set printing errors and help to stderr
+func (c cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// parse parses args, usage errors were printed by the flag set
+func parse(fs *flag.FlagSet, args []string, positional int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() != positional {
+		fmt.Fprintf(fs.Output(), "%s: want %d arguments, got %d\n", fs.Name(), positional, fs.NArg())
+		return errUsage
+	}
+	return nil
+}
+
+// subcommand splits off the subcommand name, printing usage when it is missing
+func (c cli) subcommand(cmd string, args []string) (string, []string, error) {
+	if len(args) == 0 {
+		fmt.Fprintf(c.stderr, "%s: missing subcommand\n\n%s", cmd, usage)
+		return "", nil, errUsage
+	}
+	return args[0], args[1:], nil
+}
+
+func (c cli) unknownSubcommand(cmd, sub string) error {
+	fmt.Fprintf(c.stderr, "%s: unknown subcommand %q\n\n%s", cmd, sub, usage)
+	return errUsage
+}
+
+func (c cli) serve(args []string) error {
+	if err := parse(c.flags("serve"), args, 0); err != nil {
+		return err
+	}
+	config, err := c.loadConfig(true)
+	if err != nil {
+		return err
+	}
+	return runServe(config)
+}
+
+// connect opens the database for commands that don't start the app
+func (c cli) connect(ctx context.Context) (*db.PostgresDB, *cfg.Config, error) {
+	config, err := c.loadConfig(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	database, err := db.NewPostgresDb(config.Db, ctx, logger.L())
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return database, config, nil
+}
+
+// migrationSources returns the core migrations followed by those of the modules, in the
+// order serve applies them
+func migrationSources() []migrations.Source {
+	sources := []migrations.Source{migrations.Core()}
+	for _, m := range module.All() {
+		if src, ok := module.MigrationSource(m); ok {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+func findSource(name string) (migrations.Source, error) {
+	var names []string
+	for _, src := range migrationSources() {
+		if src.Name == name {
+			return src, nil
+		}
+		names = append(names, src.Name)
+	}
+	return migrations.Source{}, fmt.Errorf("no migration source %q, have %s", name, strings.Join(names, ", "))
+}
+
+func (c cli) migrate(args []string) error {
+	sub, args, err := c.subcommand("migrate", args)
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "up":
+		return c.migrateUp(args)
+	case "down":
+		return c.migrateDown(args)
+	case "goto":
+		return c.migrateGoto(args)
+	case "status":
+		return c.migrateStatus(args)
+	case "force":
+		return c.migrateForce(args)
+	case "create":
+		return c.migrateCreate(args)
+	}
+	return c.unknownSubcommand("migrate", sub)
+}
+
+// currentVersion reads the version a dry run plans from, a dirty database has to be forced first
+func currentVersion(ctx context.Context, database *db.PostgresDB, src migrations.Source) (uint, error) {
+	report, err := migrations.Status(ctx, database.Pool, src)
+	if err != nil {
+		return 0, err
+	}
+	if report.Dirty {
+		return 0, fmt.Errorf("%s is dirty at version %d, force a version first", src.Name, report.Version)
+	}
+	return report.Version, nil
+}
+
+// printPlan writes the SQL moving src from one version to another would run
+func (c cli) printPlan(src migrations.Source, from, to uint) error {
+	steps, err := src.Plan(from, to)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src.Name, err)
+	}
+	if len(steps) == 0 {
+		fmt.Fprintf(c.stdout, "-- %s: nothing to do at version %d\n", src.Name, from)
+		return nil
+	}
+	for _, step := range steps {
+		fmt.Fprintf(c.stdout, "-- %s: %s\n%s\n", src.Name, step.File(), strings.TrimRight(step.SQL, "\n"))
+	}
+	return nil
+}
+
+func (c cli) migrateUp(args []string) error {
+	fs := c.flags("migrate up")
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of running it")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, config, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	if !*dryRun {
+		// takes the same lock as serve, so it is safe while instances start
+		wait := time.Duration(config.Db.MigrationWait) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), wait+dbMigrationTimeout)
+		defer cancel()
+		outcome, err := migrations.RunLocked(ctx, database.Pool, logger.L(), migrationSources(), wait)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, outcome)
+		return nil
+	}
+	for _, src := range migrationSources() {
+		from, err := currentVersion(ctx, database, src)
+		if err != nil {
+			return err
+		}
+		latest, err := src.Latest()
+		if err != nil {
+			return err
+		}
+		if err := c.printPlan(src, from, max(from, latest)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c cli) migrateDown(args []string) error {
+	fs := c.flags("migrate down")
+	n := fs.Int("n", 1, "number of migrations to roll back")
+	all := fs.Bool("all", false, "roll back every migration of the source")
+	source := fs.String("source", "core", "migration source, core or a module name")
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of running it")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *n < 1 {
+		return errors.New("-n must be at least 1")
+	}
+	src, err := findSource(*source)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, config, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	if *dryRun {
+		from, err := currentVersion(ctx, database, src)
+		if err != nil {
+			return err
+		}
+		var to uint
+		if !*all {
+			if to, err = src.Target(from, -*n); err != nil {
+				return err
+			}
+		}
+		return c.printPlan(src, from, to)
+	}
+
+	// takes the lock serve migrates under, waiting for instances that are starting
+	wait := time.Duration(config.Db.MigrationWait) * time.Second
+	ctx, cancel = context.WithTimeout(context.Background(), wait+dbMigrationTimeout)
+	defer cancel()
+	if *all {
+		err = migrations.Down(ctx, database.Pool, src, wait)
+	} else {
+		err = migrations.Steps(ctx, database.Pool, src, -*n, wait)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printVersion(ctx, database, src)
+}
+
+func (c cli) migrateGoto(args []string) error {
+	fs := c.flags("migrate goto")
+	source := fs.String("source", "core", "migration source, core or a module name")
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of running it")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	version, err := strconv.ParseUint(fs.Arg(0), 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid version %q", fs.Arg(0))
+	}
+	src, err := findSource(*source)
+	if err != nil {
+		return err
+	}
+	list, err := src.Migrations()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(list, func(m migrations.Migration) bool { return m.Version == uint(version) }) {
+		return fmt.Errorf("%s has no migration %d, use migrate down -all to remove every migration", src.Name, version)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, config, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	if *dryRun {
+		from, err := currentVersion(ctx, database, src)
+		if err != nil {
+			return err
+		}
+		return c.printPlan(src, from, uint(version))
+	}
+	wait := time.Duration(config.Db.MigrationWait) * time.Second
+	ctx, cancel = context.WithTimeout(context.Background(), wait+dbMigrationTimeout)
+	defer cancel()
+	if err := migrations.Migrate(ctx, database.Pool, src, uint(version), wait); err != nil {
+		return err
+	}
+	return c.printVersion(ctx, database, src)
+}
+
+func (c cli) printVersion(ctx context.Context, database *db.PostgresDB, src migrations.Source) error {
+	report, err := migrations.Status(ctx, database.Pool, src)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "%s is at version %d\n", src.Name, report.Version)
+	return nil
+}
+
+// migrateStatus lists every migration of every source as applied or pending
+func (c cli) migrateStatus(args []string) error {
+	fs := c.flags("migrate status")
+	source := fs.String("source", "", "only this source, core or a module name")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	sources := migrationSources()
+	if *source != "" {
+		src, err := findSource(*source)
+		if err != nil {
+			return err
+		}
+		sources = []migrations.Source{src}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, _, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tVERSION\tNAME\tSTATE")
+	for _, src := range sources {
+		report, err := migrations.Status(ctx, database.Pool, src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src.Name, err)
+		}
+		for _, m := range report.Applied {
+			state := "applied"
+			if report.Dirty && m.Version == report.Version {
+				state = "dirty"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", src.Name, m.Version, migrationLabel(m), state)
+		}
+		for _, m := range report.Pending {
+			fmt.Fprintf(tw, "%s\t%d\t%s\tpending\n", src.Name, m.Version, migrationLabel(m))
+		}
+		// a newer release migrated past what this binary knows about
+		if n := len(report.Applied); report.Version > 0 && (n == 0 || report.Applied[n-1].Version < report.Version) {
+			fmt.Fprintf(tw, "%s\t%d\t\tunknown, newer than this binary\n", src.Name, report.Version)
+		}
+	}
+	return tw.Flush()
+}
+
+func migrationLabel(m migrations.Migration) string {
+	if m.IsGo() {
+		return m.Name + " (Go)"
+	}
+	return m.Name
+}
+
+func (c cli) migrateForce(args []string) error {
+	fs := c.flags("migrate force")
+	source := fs.String("source", "core", "migration source, core or a module name")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || version < -1 {
+		return fmt.Errorf("invalid version %q, want a version number or -1 for none", fs.Arg(0))
+	}
+	src, err := findSource(*source)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, config, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	wait := time.Duration(config.Db.MigrationWait) * time.Second
+	ctx, cancel = context.WithTimeout(context.Background(), wait+cliTimeout)
+	defer cancel()
+	if err := migrations.Force(ctx, database.Pool, src, version, wait); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "%s forced to version %d\n", src.Name, version)
+	return nil
+}
+
+var migrationName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// migrateCreate adds an up and down file with the next version, it needs no config
+func (c cli) migrateCreate(args []string) error {
+	fs := c.flags("migrate create")
+	dir := fs.String("dir", filepath.Join("migrations", "postgres"), "directory of the migrations")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	name := strings.Trim(migrationName.ReplaceAllString(strings.ToLower(fs.Arg(0)), "_"), "_")
+	if name == "" {
+		return fmt.Errorf("invalid name %q", fs.Arg(0))
+	}
+
+	latest, err := migrations.Source{FS: os.DirFS(*dir)}.Latest()
+	if err != nil {
+		return err
+	}
+	base := fmt.Sprintf("%04d_%s", latest+1, name)
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(*dir, base+"."+direction+".sql")
+		// O_EXCL so a typo in -dir can't overwrite anything
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "-- %s %s\n", base, direction)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, path)
+	}
+	return nil
+}
+
+func (c cli) user(args []string) error {
+	sub, args, err := c.subcommand("user", args)
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "create":
+		return c.userCreate(args)
+	case "set-password":
+		return c.userSetPassword(args)
+	case "grant-admin":
+		return c.userGrantAdmin(args)
+	case "invite":
+		return c.userInvite(args)
+	}
+	return c.unknownSubcommand("user", sub)
+}
+
+// readPassword reads one line from stdin, so the password stays out of the shell history and
+// the process list. The prompt goes to stderr, piping the password in works too.
+func (c cli) readPassword() (string, error) {
+	fmt.Fprint(c.stderr, "Password: ")
+	line, err := bufio.NewReader(c.stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
+
+// normalizeEmail applies the syntax and length checks of the HTTP signup to -email
+func normalizeEmail(email string) (string, error) {
+	if strings.TrimSpace(email) == "" {
+		return "", errors.New("-email is required")
+	}
+	addr, err := authutil.NormalizeEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("-email: %w", err)
+	}
+	return addr, nil
+}
+
+func (c cli) userCreate(args []string) error {
+	fs := c.flags("user create")
+	email := fs.String("email", "", "email address, also the login")
+	name := fs.String("name", "", "display name, the local part of the email by default")
+	admin := fs.Bool("admin", false, "grant admin rights")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	addr, err := normalizeEmail(*email)
+	if err != nil {
+		return err
+	}
+	// the same rule as the HTTP signup, which requires a name
+	displayName := strings.TrimSpace(*name)
+	if displayName == "" {
+		displayName = strings.SplitN(addr, "@", 2)[0]
+	}
+	if utf8.RuneCountInString(displayName) > maxNameLen {
+		return fmt.Errorf("-name must be at most %d characters", maxNameLen)
+	}
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	hash, err := handlers.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, _, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	exists, err := database.EmailExists(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("check email existence: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("a user with email %s already exists", addr)
+	}
+	// created by an operator, the signup policy and email verification don't apply
+	user, err := database.CreateUser(ctx, models.User{
+		Name:          displayName,
+		Email:         addr,
+		EmailVerified: true,
+		PasswordHash:  hash,
+		AuthProvider:  models.AuthProviderLocal,
+	})
+	if err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+	if *admin {
+		if err := database.SetUserAdmin(ctx, user.Id, true); err != nil {
+			return fmt.Errorf("grant admin: %w", err)
+		}
+	}
+	fmt.Fprintf(c.stdout, "created user %s (%s)\n", addr, user.Id)
+	return nil
+}
+
+func (c cli) userSetPassword(args []string) error {
+	fs := c.flags("user set-password")
+	email := fs.String("email", "", "email address of the user")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	addr, err := normalizeEmail(*email)
+	if err != nil {
+		return err
+	}
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	hash, err := handlers.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, _, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	user, err := database.GetUserByEmail(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if user.AuthProvider != models.AuthProviderLocal {
+		return fmt.Errorf("%s signs in with %s, not a password", addr, user.AuthProvider)
+	}
+	if err := database.SetUserPassword(ctx, user.Id, hash); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "password of %s updated\n", addr)
+	return nil
+}
+
+func (c cli) userGrantAdmin(args []string) error {
+	fs := c.flags("user grant-admin")
+	email := fs.String("email", "", "email address of the user")
+	revoke := fs.Bool("revoke", false, "take admin rights away instead")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	addr, err := normalizeEmail(*email)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, _, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	user, err := database.GetUserByEmail(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if err := database.SetUserAdmin(ctx, user.Id, !*revoke); err != nil {
+		return err
+	}
+	// sessions carry the admin flag, it changes with the next token refresh
+	if *revoke {
+		fmt.Fprintf(c.stdout, "revoked admin from %s\n", addr)
+	} else {
+		fmt.Fprintf(c.stdout, "granted admin to %s\n", addr)
+	}
+	return nil
+}
+
+func (c cli) userInvite(args []string) error {
+	fs := c.flags("user invite")
+	email := fs.String("email", "", "email address to invite")
+	ttl := fs.Duration("ttl", 7*24*time.Hour, "how long the invite stays valid")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	addr, err := normalizeEmail(*email)
+	if err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return errors.New("-ttl must be positive")
+	}
+	tkn, err := authutil.RandomToken()
+	if err != nil {
+		return fmt.Errorf("generate invite: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	database, config, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Pool.Close()
+
+	exists, err := database.EmailExists(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("check email existence: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("a user with email %s already exists", addr)
+	}
+	expiresAt := time.Now().Add(*ttl)
+	// only the hash is stored, the token is shown this once
+	if err := database.CreateSignupInvite(ctx, addr, authutil.HashToken(tkn), expiresAt); err != nil {
+		return fmt.Errorf("create invite: %w", err)
+	}
+	if config.Auth.Signup.Mode != cfg.SignupModeInvite {
+		fmt.Fprintf(c.stderr, "warning: SIGNUP_MODE is %s, invites are only checked in invite mode\n", config.Auth.Signup.Mode)
+	}
+	fmt.Fprintf(c.stdout, "invited %s until %s\n", addr, expiresAt.Format(time.RFC3339))
+	fmt.Fprintf(c.stdout, "sign up at %s/auth/local/signup with \"invite\": %q, or log in with a login link sent to the address\n",
+		config.PublicURL, tkn)
+	return nil
+}
+
+func (c cli) config(args []string) error {
+	sub, args, err := c.subcommand("config", args)
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "check":
+		if err := parse(c.flags("config check"), args, 0); err != nil {
+			return err
+		}
+		config, err := c.loadConfig(false)
+		if err != nil {
+			return err
+		}
+		// building the app loads keys and certificates and initializes the modules without
+		// connecting anywhere
+		if _, _, err := newApp(config); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, "OK")
+		return nil
+	case "print":
+		if err := parse(c.flags("config print"), args, 0); err != nil {
+			return err
+		}
+		config, err := c.loadConfig(false)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(config.Redacted())
+	}
+	return c.unknownSubcommand("config", sub)
+}
+
+// healthcheck exits non-zero unless the server answers its health endpoint, Docker images have
+// no curl to do it
+func (c cli) healthcheck(args []string) error {
+	fs := c.flags("healthcheck")
+	live := fs.Bool("live", false, "probe liveness instead of readiness")
+	rawURL := fs.String("url", "", "endpoint to probe, defaults to the configured host and port")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	url := *rawURL
+	client := &http.Client{Timeout: healthcheckTimeout}
+	if url == "" {
+		config, err := c.loadConfig(false)
+		if err != nil {
+			return err
+		}
+		host := config.Host
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		scheme := "http"
+		if config.Server.TLS.Enabled {
+			// the certificate is issued for the public name, not the loopback address
+			scheme = "https"
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		}
+		path := "/api/health"
+		if *live {
+			path = "/api/health/live"
+		}
+		url = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(config.APIPort)) + path
+	}
+
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, res.Status)
+	}
+	return nil
+}
+
+// routes lists the patterns of the public server
+func (c cli) routes(args []string) error {
+	if err := parse(c.flags("routes"), args, 0); err != nil {
+		return err
+	}
+	config, err := c.loadConfig(false)
+	if err != nil {
+		return err
+	}
+	_, rt, err := newApp(config)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range rt.Patterns() {
+		fmt.Fprintln(c.stdout, pattern)
+	}
+	return nil
+}
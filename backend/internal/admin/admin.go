@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/rs/zerolog"
+)
+
+// CodeInvalidLogLevel is the problem code for log level changes to an unknown level
+const CodeInvalidLogLevel = "invalid_log_level"
+
+// Options selects the endpoints of the admin server
+type Options struct {
+	Metrics http.Handler // served at /metrics, nil leaves it out
+	Pprof   bool         // serve net/http/pprof under /debug/pprof/
+	Health  http.Handler // served at /debug/health, for the readiness report with error messages
+}
+
+// BuildInfo is returned by /debug/info
+type BuildInfo struct {
+	GoVersion  string            `json:"go_version"`
+	Path       string            `json:"path,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	Settings   map[string]string `json:"settings,omitempty"` // vcs revision, build flags, ...
+	GOOS       string            `json:"goos"`
+	GOARCH     string            `json:"goarch"`
+	NumCPU     int               `json:"num_cpu"`
+	GOMAXPROCS int               `json:"gomaxprocs"`
+	Goroutines int               `json:"goroutines"`
+	StartedAt  time.Time         `json:"started_at"`
+	Uptime     string            `json:"uptime"`
+}
+
+// LogLevel is returned and accepted by /debug/loglevel
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// NewServer creates the operational server. It has no authentication, bind it to an address
+// only operators and the metrics scraper can reach.
+func NewServer(addr string, opts Options) *http.Server {
+	return &http.Server{
+		Addr: addr,
+		// no access log, scrapers would flood it
+		Handler:           NewHandler(opts),
+		ReadHeaderTimeout: 5 * time.Second,
+		// no WriteTimeout, CPU profiles and traces stream for as long as requested
+		IdleTimeout: 120 * time.Second,
+	}
+}
+
+// NewHandler returns the mux served by NewServer
+func NewHandler(opts Options) http.Handler {
+	started := time.Now()
+	mux := http.NewServeMux()
+
+	if opts.Metrics != nil {
+		mux.Handle("GET /metrics", opts.Metrics)
+	}
+	if opts.Pprof {
+		// Index also serves the named profiles like heap and goroutine
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if opts.Health != nil {
+		mux.Handle("GET /debug/health", opts.Health)
+	}
+	mux.HandleFunc("GET /debug/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, buildInfo(started))
+	})
+	mux.HandleFunc("GET /debug/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, LogLevel{Level: zerolog.GlobalLevel().String()})
+	})
+	mux.HandleFunc("PUT /debug/loglevel", setLogLevel)
+	return mux
+}
+
+// setLogLevel changes the global level until the next restart, LOG_LEVEL applies again after it
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	req, err := request.DecodeLimit[LogLevel](w, r, 1<<10)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(req.Level)))
+	if err != nil || level == zerolog.NoLevel {
+		apperr.Write(w, r, apperr.BadRequest(CodeInvalidLogLevel,
+			"level must be one of trace, debug, info, warn, error, fatal, panic or disabled"))
+		return
+	}
+
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(level)
+	// logged at warn so the change shows up at every level but error and above
+	logger.L().WithLevel(zerolog.WarnLevel).Str("from", previous.String()).Str("to", level.String()).Msg("Log level changed")
+	writeJSON(w, LogLevel{Level: level.String()})
+}
+
+func buildInfo(started time.Time) BuildInfo {
+	info := BuildInfo{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		StartedAt:  started.UTC(),
+		Uptime:     time.Since(started).Round(time.Second).String(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path = bi.Main.Path
+		info.Version = bi.Main.Version
+		info.Settings = make(map[string]string, len(bi.Settings))
+		for _, s := range bi.Settings {
+			info.Settings[s.Key] = s.Value
+		}
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Cache-Control", "no-store")
+	request.WriteJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestHandler(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("up 1\n")) })
+
+	tests := []struct {
+		name string
+		opts Options
+		path string
+		want int
+	}{
+		{name: "metrics", opts: Options{Metrics: metrics}, path: "/metrics", want: http.StatusOK},
+		{name: "metrics off", path: "/metrics", want: http.StatusNotFound},
+		{name: "pprof", opts: Options{Pprof: true}, path: "/debug/pprof/", want: http.StatusOK},
+		{name: "pprof named profile", opts: Options{Pprof: true}, path: "/debug/pprof/goroutine?debug=1", want: http.StatusOK},
+		{name: "pprof off", path: "/debug/pprof/", want: http.StatusNotFound},
+		{name: "info", path: "/debug/info", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewHandler(tt.opts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/info", nil))
+
+	var info BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.GoVersion == "" || info.Goroutines == 0 || info.StartedAt.IsZero() {
+		t.Errorf("incomplete build info: %+v", info)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	h := NewHandler(Options{})
+
+	tests := []struct {
+		name      string
+		body      string
+		want      int
+		wantLevel zerolog.Level
+	}{
+		{name: "change", body: `{"level":"debug"}`, want: http.StatusOK, wantLevel: zerolog.DebugLevel},
+		{name: "case and spaces", body: `{"level":" WARN "}`, want: http.StatusOK, wantLevel: zerolog.WarnLevel},
+		{name: "unknown level", body: `{"level":"loud"}`, want: http.StatusBadRequest, wantLevel: zerolog.WarnLevel},
+		{name: "empty level", body: `{"level":""}`, want: http.StatusBadRequest, wantLevel: zerolog.WarnLevel},
+		{name: "not json", body: `debug`, want: http.StatusBadRequest, wantLevel: zerolog.WarnLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := zerolog.GlobalLevel(); got != tt.wantLevel {
+				t.Errorf("level = %s, want %s", got, tt.wantLevel)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/loglevel", nil))
+	var got LogLevel
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Level != "warn" {
+		t.Errorf("GET level = %q, want warn", got.Level)
+	}
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+)
+
+// Component is a named part of the application with lifecycle hooks. Both hooks are optional.
+type Component struct {
+	Name      string
+	DependsOn []string // components started before this one and stopped after it
+
+	// Start must return once the component is ready, long running work goes in a goroutine
+	// that reports failures with App.Fail. A failing Start cleans up after itself, Stop is
+	// only called for started components.
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// App starts components in dependency order and stops them in reverse. Components are built
+// before they are registered, so tests can construct the app and swap any of them with Replace.
+type App struct {
+	components []Component
+
+	mu      sync.Mutex
+	started []Component // in start order
+	failed  chan error
+}
+
+// New creates an app without components
+func New() *App {
+	return &App{failed: make(chan error, 1)}
+}
+
+// Register adds a component, names must be unique
+func (a *App) Register(c Component) {
+	for _, existing := range a.components {
+		if existing.Name == c.Name {
+			panic(fmt.Sprintf("app: component %q registered twice", c.Name))
+		}
+	}
+	a.components = append(a.components, c)
+}
+
+// Replace swaps the hooks of a registered component, the dependencies stay as registered
+func (a *App) Replace(name string, start, stop func(ctx context.Context) error) error {
+	for i := range a.components {
+		if a.components[i].Name == name {
+			a.components[i].Start, a.components[i].Stop = start, stop
+			return nil
+		}
+	}
+	return fmt.Errorf("app: no component %q", name)
+}
+
+// Order returns the component names in start order, dependencies first and otherwise in
+// registration order
+func (a *App) Order() ([]string, error) {
+	ordered, err := a.order()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ordered))
+	for i, c := range ordered {
+		names[i] = c.Name
+	}
+	return names, nil
+}
+
+func (a *App) order() ([]Component, error) {
+	byName := make(map[string]Component, len(a.components))
+	for _, c := range a.components {
+		byName[c.Name] = c
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var ordered []Component
+	var visit func(c Component, path []string) error
+	visit = func(c Component, path []string) error {
+		switch state[c.Name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("app: dependency cycle %v", append(path, c.Name))
+		}
+		state[c.Name] = visiting
+		for _, dep := range c.DependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("app: %s depends on unknown component %q", c.Name, dep)
+			}
+			if err := visit(d, append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+		state[c.Name] = done
+		ordered = append(ordered, c)
+		return nil
+	}
+	for _, c := range a.components {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Start runs the start hooks in order. When one fails the components started so far are
+// stopped again with ctx, so a failed startup doesn't leak connections or listeners.
+func (a *App) Start(ctx context.Context) error {
+	ordered, err := a.order()
+	if err != nil {
+		return err
+	}
+	for _, c := range ordered {
+		if c.Start != nil {
+			start := time.Now()
+			if err := c.Start(ctx); err != nil {
+				stopErr := a.Stop(context.WithoutCancel(ctx))
+				return errors.Join(fmt.Errorf("start %s: %w", c.Name, err), stopErr)
+			}
+			logger.L().Debug().Str("component", c.Name).Dur("duration", time.Since(start)).Msg("Component started")
+		}
+		a.mu.Lock()
+		a.started = append(a.started, c)
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of the started components in reverse order. Every component is
+// stopped even when an earlier one fails, the errors are joined.
+func (a *App) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	started := a.started
+	a.started = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		if c.Stop == nil {
+			continue
+		}
+		start := time.Now()
+		if err := c.Stop(ctx); err != nil {
+			logger.L().Error().Err(err).Str("component", c.Name).Msg("Component failed to stop")
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+			continue
+		}
+		logger.L().Debug().Str("component", c.Name).Dur("duration", time.Since(start)).Msg("Component stopped")
+	}
+	return errors.Join(errs...)
+}
+
+// Fail reports that a running component broke, Run stops the app. Only the first failure is kept.
+func (a *App) Fail(err error) {
+	select {
+	case a.failed <- err:
+	default:
+	}
+}
+
+// Run starts the app, waits until ctx is canceled or a component fails, then stops it within
+// stopTimeout, 0 waits for the stop hooks however long they take
+func (a *App) Run(ctx context.Context, stopTimeout time.Duration) error {
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-a.failed:
+		logger.L().Error().Err(runErr).Msg("Component failed, stopping")
+	}
+
+	sctx, cancel := context.WithCancel(context.Background())
+	if stopTimeout > 0 {
+		sctx, cancel = context.WithTimeout(context.Background(), stopTimeout)
+	}
+	defer cancel()
+	return errors.Join(runErr, a.Stop(sctx))
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder collects hook calls in order
+type recorder struct{ calls []string }
+
+func (r *recorder) component(name string, deps ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: deps,
+		Start:     func(context.Context) error { r.calls = append(r.calls, "start "+name); return nil },
+		Stop:      func(context.Context) error { r.calls = append(r.calls, "stop "+name); return nil },
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []Component
+		want       []string
+		wantErr    string
+	}{
+		{name: "registration order", components: []Component{{Name: "a"}, {Name: "b"}}, want: []string{"a", "b"}},
+		{name: "dependencies first", components: []Component{
+			{Name: "http", DependsOn: []string{"migrations", "db"}},
+			{Name: "migrations", DependsOn: []string{"db"}},
+			{Name: "db"},
+		}, want: []string{"db", "migrations", "http"}},
+		{name: "unknown dependency", components: []Component{{Name: "http", DependsOn: []string{"db"}}},
+			wantErr: `depends on unknown component "db"`},
+		{name: "cycle", components: []Component{
+			{Name: "a", DependsOn: []string{"b"}},
+			{Name: "b", DependsOn: []string{"a"}},
+		}, wantErr: "dependency cycle [a b a]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New()
+			for _, c := range tt.components {
+				a.Register(c)
+			}
+			got, err := a.Order()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	rec := &recorder{}
+	a := New()
+	a.Register(rec.component("http", "db"))
+	a.Register(rec.component("db"))
+
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start db", "start http", "stop http", "stop db"}
+	if !slices.Equal(rec.calls, want) {
+		t.Errorf("calls = %v, want %v", rec.calls, want)
+	}
+
+	// stopping again does nothing
+	if err := a.Stop(context.Background()); err != nil || len(rec.calls) != len(want) {
+		t.Errorf("second Stop ran hooks: %v", rec.calls)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	rec := &recorder{}
+	a := New()
+	a.Register(rec.component("db"))
+	a.Register(rec.component("migrations", "db"))
+	a.Register(rec.component("http", "migrations"))
+	if err := a.Replace("migrations", func(context.Context) error { return errors.New("dirty") }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err := a.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "start migrations: dirty") {
+		t.Fatalf("err = %v, want the migrations failure", err)
+	}
+	// only what started is stopped again
+	want := []string{"start db", "stop db"}
+	if !slices.Equal(rec.calls, want) {
+		t.Errorf("calls = %v, want %v", rec.calls, want)
+	}
+}
+
+func TestStopErrors(t *testing.T) {
+	rec := &recorder{}
+	a := New()
+	a.Register(rec.component("db"))
+	a.Register(Component{Name: "cache", Stop: func(context.Context) error { return errors.New("flush failed") }})
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := a.Stop(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "stop cache: flush failed") {
+		t.Errorf("err = %v, want the cache failure", err)
+	}
+	if !slices.Contains(rec.calls, "stop db") {
+		t.Error("a failing stop hook kept later components running")
+	}
+}
+
+func TestReplaceUnknown(t *testing.T) {
+	if err := New().Replace("db", nil, nil); err == nil {
+		t.Error("Replace accepted an unknown component")
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("canceled", func(t *testing.T) {
+		rec := &recorder{}
+		a := New()
+		a.Register(rec.component("db"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := a.Run(ctx, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"start db", "stop db"}; !slices.Equal(rec.calls, want) {
+			t.Errorf("calls = %v, want %v", rec.calls, want)
+		}
+	})
+
+	t.Run("component failure", func(t *testing.T) {
+		rec := &recorder{}
+		a := New()
+		a.Register(rec.component("db"))
+		a.Register(Component{Name: "http", Start: func(context.Context) error {
+			go a.Fail(errors.New("listener closed"))
+			return nil
+		}})
+		err := a.Run(context.Background(), time.Second)
+		if err == nil || !strings.Contains(err.Error(), "listener closed") {
+			t.Errorf("err = %v, want the component failure", err)
+		}
+		if !slices.Contains(rec.calls, "stop db") {
+			t.Error("app wasn't stopped after a component failed")
+		}
+	})
+}
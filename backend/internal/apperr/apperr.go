@@ -0,0 +1,143 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+)
+
+// ContentType is the media type of problem details responses (RFC 9457)
+const ContentType = "application/problem+json"
+
+// Machine-readable codes shared across handlers, feature specific codes live next to their handlers
+const (
+	CodeValidation   = "validation_failed"
+	CodeConflict     = "conflict"
+	CodeNotFound     = "not_found"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeUnavailable  = "unavailable"
+	CodeInternal     = "internal_error"
+)
+
+// FieldError describes a single invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an application error that knows how to render itself as a problem response
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Err is the underlying cause, it is logged but never sent to the client
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Validation reports invalid input, the message joins the field messages
+func Validation(fields ...FieldError) *Error {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidation,
+		Message: strings.Join(msgs, "; "),
+		Fields:  fields,
+	}
+}
+
+// BadRequest reports a request that could not be parsed
+func BadRequest(code, msg string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: code, Message: msg}
+}
+
+// Conflict reports a request that clashes with existing state
+func Conflict(code, msg string) *Error {
+	return &Error{Status: http.StatusConflict, Code: code, Message: msg}
+}
+
+// NotFound reports a missing resource
+func NotFound(code, msg string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: code, Message: msg}
+}
+
+// Unauthorized reports missing or invalid credentials
+func Unauthorized(code, msg string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: code, Message: msg}
+}
+
+// Forbidden reports an authenticated or anonymous caller that is not allowed to do this
+func Forbidden(code, msg string) *Error {
+	return &Error{Status: http.StatusForbidden, Code: code, Message: msg}
+}
+
+// Unavailable reports a dependency that is down
+func Unavailable(msg string, err error) *Error {
+	return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: msg, Err: err}
+}
+
+// Internal wraps an unexpected error, the client only sees a generic message
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// Problem is the RFC 9457 problem details body with our extension members
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// From converts any error to an *Error, unknown errors become internal errors
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err)
+}
+
+// Write renders err as a problem response. Server errors are logged with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	if e.Status >= http.StatusInternalServerError {
+		logger.Ctx(r.Context()).Error().Err(e.Err).Str("code", e.Code).Msg(e.Message)
+	}
+
+	p := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		Errors:    e.Fields,
+		RequestID: logger.RequestID(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
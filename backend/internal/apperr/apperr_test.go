@@ -0,0 +1,83 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+		wantFields int
+	}{
+		{
+			name:       "validation",
+			err:        Validation(FieldError{Field: "email", Code: "required", Message: "email cannot be empty"}, FieldError{Field: "name", Code: "required", Message: "name cannot be empty"}),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeValidation,
+			wantDetail: "email cannot be empty; name cannot be empty",
+			wantFields: 2,
+		},
+		{
+			name:       "conflict",
+			err:        Conflict("email_exists", "email already exists"),
+			wantStatus: http.StatusConflict,
+			wantCode:   "email_exists",
+			wantDetail: "email already exists",
+		},
+		{
+			name:       "wrapped app error",
+			err:        fmt.Errorf("lookup: %w", NotFound(CodeNotFound, "user not found")),
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+			wantDetail: "user not found",
+		},
+		{
+			name:       "unknown error hides the cause",
+			err:        errors.New("pq: connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+			wantDetail: "internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/local/signup", nil)
+			req = req.WithContext(logger.WithRequestID(req.Context(), "req-1"))
+			rec := httptest.NewRecorder()
+			Write(rec, req, tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+			}
+
+			var p Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if p.Status != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail {
+				t.Errorf("problem = %+v, want status %d code %q detail %q", p, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+			if p.Title != http.StatusText(tt.wantStatus) || p.Instance != "/auth/local/signup" || p.RequestID != "req-1" {
+				t.Errorf("problem = %+v, want title, instance and request id set", p)
+			}
+			if len(p.Errors) != tt.wantFields {
+				t.Errorf("errors = %v, want %d field errors", p.Errors, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package authutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenLen is the number of random bytes in a token
+const tokenLen = 32
+
+// MaxEmailLen is the longest address accepted, the limit of the SMTP path (RFC 5321).
+// Request structs enforce it with validate:"max=254".
+const MaxEmailLen = 254
+
+// NormalizeEmail lowercases and syntactically validates an email address
+func NormalizeEmail(raw string) (string, error) {
+	email := strings.TrimSpace(strings.ToLower(raw))
+	if email == "" {
+		return "", fmt.Errorf("email cannot be empty")
+	}
+	if utf8.RuneCountInString(email) > MaxEmailLen {
+		return "", fmt.Errorf("email must be at most %d characters", MaxEmailLen)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return email, nil
+}
+
+// RandomToken returns a random url-safe token for links, codes and states
+func RandomToken() (string, error) {
+	b := make([]byte, tokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex sha256 of a token, only the hash is stored in the database
+func HashToken(tkn string) string {
+	sum := sha256.Sum256([]byte(tkn))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package authutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "valid email",
+			input: "user@example.com",
+			want:  "user@example.com",
+		},
+		{
+			name:  "mixed case and whitespace",
+			input: "  User@Example.COM ",
+			want:  "user@example.com",
+		},
+		{
+			name:    "empty email",
+			input:   "   ",
+			wantErr: true,
+		},
+		{
+			name:    "missing domain",
+			input:   "user@",
+			wantErr: true,
+		},
+		{
+			name:    "too long",
+			input:   strings.Repeat("a", 64) + "@" + strings.Repeat("b", 186) + ".com",
+			wantErr: true,
+		},
+		{
+			name:    "display name form",
+			input:   "User <user@example.com>",
+			wantErr: true,
+		},
+		{
+			name:    "header injection",
+			input:   "user@example.com\r\nBcc: victim@example.com",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	tkn1, err := RandomToken()
+	if err != nil {
+		t.Fatalf("RandomToken() error = %v", err)
+	}
+	tkn2, err := RandomToken()
+	if err != nil {
+		t.Fatalf("RandomToken() error = %v", err)
+	}
+
+	if tkn1 == tkn2 {
+		t.Errorf("RandomToken() produced identical tokens: %s", tkn1)
+	}
+	// 32 random bytes in unpadded base64url
+	if len(tkn1) != 43 {
+		t.Errorf("RandomToken() length = %d, want 43", len(tkn1))
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("token")
+
+	if hash != HashToken("token") {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if hash == HashToken("other") {
+		t.Errorf("HashToken() produced identical hashes for different tokens")
+	}
+	if len(hash) != 64 {
+		t.Errorf("HashToken() length = %d, want 64", len(hash))
+	}
+}
@@ -0,0 +1,166 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+)
+
+// CodeClientCertRequired is the problem code for requests to mTLS paths without a verified certificate
+const CodeClientCertRequired = "client_cert_required"
+
+// Reloader serves the certificate and client CAs from disk and swaps them in when the
+// files change, handshakes in flight keep the config they started with.
+type Reloader struct {
+	conf    cfg.TLSConfig
+	current atomic.Pointer[tls.Config]
+
+	mu    sync.Mutex // serializes reloads from Watch and SIGHUP
+	stamp string     // modification times and sizes of the files the current config was loaded from
+}
+
+// NewReloader loads the configured files, a broken file fails startup instead of the first handshake
+func NewReloader(conf cfg.TLSConfig) (*Reloader, error) {
+	r := &Reloader{conf: conf}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig is the config for http.Server, every handshake gets the latest loaded files
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.conf.MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Reload reads the files again, the current config stays in place if they are invalid
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return err
+	}
+	// a broken file is reported once, Watch tries again when it changes
+	r.stamp = stamp
+
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   r.conf.MinVersion,
+		CipherSuites: r.conf.CipherSuites,
+		// GetConfigForClient replaces the config http.Server prepared, so HTTP/2 has to be offered here
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if r.conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("client CA bundle contains no certificates")
+		}
+		conf.ClientCAs = pool
+		// public routes stay reachable without a certificate, RequireClientCert guards the rest
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r.current.Store(conf)
+	logger.L().Info().Str("cert", r.conf.CertFile).Time("not_after", cert.Leaf.NotAfter).
+		Strs("dns_names", cert.Leaf.DNSNames).Msg("TLS certificate loaded")
+	return nil
+}
+
+// Watch reloads the files every interval when they have changed, until ctx is canceled.
+// Certificate managers like cert-manager and certbot replace the files in place.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logger.L().Error().Err(err).Msg("Failed to reload TLS certificate, keeping the current one")
+			}
+		}
+	}
+}
+
+// changed reports whether the files differ from the loaded ones. Files that are missing
+// mid-replacement count as unchanged, the next check sees them again.
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stamp, err := r.fileStamp()
+	return err == nil && stamp != r.stamp
+}
+
+func (r *Reloader) fileStamp() (string, error) {
+	var b strings.Builder
+	for _, name := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s|%d|%d;", name, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
+
+// RequireClientCert rejects requests below the path prefixes that didn't present a
+// certificate verified against the client CA bundle, other paths pass through
+func RequireClientCert(prefixes []string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if !strings.HasPrefix(r.URL.Path, prefix) {
+					continue
+				}
+				if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+					apperr.Write(w, r, apperr.Forbidden(CodeClientCertRequired, "a client certificate is required"))
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
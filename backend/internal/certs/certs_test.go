@@ -0,0 +1,237 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+// testCA issues certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key with the given serial
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startServer serves h over TLS with the reloader's config
+func startServer(t *testing.T, r *Reloader, h http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(h)
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// client trusts ca, a fresh transport per call so every request does a new handshake
+func client(ca *testCA, cert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	conf := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		conf.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+}
+
+func servedSerial(t *testing.T, c *http.Client, url string) int64 {
+	t.Helper()
+	res, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	return res.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	conf := cfg.TLSConfig{
+		CertFile:   filepath.Join(dir, "tls.crt"),
+		KeyFile:    filepath.Join(dir, "tls.key"),
+		MinVersion: tls.VersionTLS12,
+	}
+	certPEM, keyPEM := ca.issue(t, 100, x509.ExtKeyUsageServerAuth)
+	writeFile(t, conf.CertFile, certPEM)
+	writeFile(t, conf.KeyFile, keyPEM)
+
+	r, err := NewReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startServer(t, r, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	if got := servedSerial(t, client(ca, nil), srv.URL); got != 100 {
+		t.Fatalf("serial = %d, want 100", got)
+	}
+
+	// a broken file keeps the current certificate
+	writeFile(t, conf.CertFile, []byte("not a certificate"))
+	if err := r.Reload(); err == nil {
+		t.Error("Reload accepted a broken certificate")
+	}
+	if got := servedSerial(t, client(ca, nil), srv.URL); got != 100 {
+		t.Errorf("after failed reload serial = %d, want 100", got)
+	}
+
+	// Watch picks up replaced files
+	certPEM, keyPEM = ca.issue(t, 200, x509.ExtKeyUsageServerAuth)
+	writeFile(t, conf.CertFile, certPEM)
+	writeFile(t, conf.KeyFile, keyPEM)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, client(ca, nil), srv.URL) != 200 {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not reload the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	conf := cfg.TLSConfig{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		MinVersion:   tls.VersionTLS13,
+	}
+	certPEM, keyPEM := ca.issue(t, 1, x509.ExtKeyUsageServerAuth)
+	writeFile(t, conf.CertFile, certPEM)
+	writeFile(t, conf.KeyFile, keyPEM)
+	writeFile(t, conf.ClientCAFile, ca.pem)
+
+	r, err := NewReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startServer(t, r, RequireClientCert([]string{"/internal/"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	clientPEM, clientKey := ca.issue(t, 2, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCA(t)
+	otherPEM, otherKey := other.issue(t, 3, x509.ExtKeyUsageClientAuth)
+	otherCert, err := tls.X509KeyPair(otherPEM, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		cert      *tls.Certificate
+		want      int
+		wantError bool
+	}{
+		{name: "public without certificate", path: "/api/health", want: http.StatusNoContent},
+		{name: "internal without certificate", path: "/internal/stats", want: http.StatusForbidden},
+		{name: "internal with certificate", path: "/internal/stats", cert: &clientCert, want: http.StatusNoContent},
+		{name: "certificate from another CA", path: "/api/health", cert: &otherCert, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client(ca, tt.cert).Get(srv.URL + tt.path)
+			if tt.wantError {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("handshake with an unknown client certificate succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.want)
+			}
+			if res.TLS.Version != tls.VersionTLS13 {
+				t.Errorf("TLS version = %x, want 1.3", res.TLS.Version)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+type ctxKey struct{}
+
+// WithIP returns a copy of ctx carrying the client address
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromContext returns the address stored by Resolver.Middleware, or "" when there is none
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+	return ip
+}
+
+// FromRequest returns the resolved client address, falling back to the peer address for
+// requests that didn't pass Resolver.Middleware
+func FromRequest(r *http.Request) string {
+	if ip := FromContext(r.Context()); ip != "" {
+		return ip
+	}
+	return peer(r)
+}
+
+// Resolver finds the client address of requests behind trusted reverse proxies. Forwarding
+// headers can be set by anyone, so they are only read when the request comes from a trusted
+// proxy, and the client is the right-most address in the chain that isn't a trusted proxy
+// itself. Everything left of it was added by the client and may be forged. Only the header
+// the proxies are configured to set is read, the others may come straight from the client.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  cfg.ProxyHeader
+}
+
+// New creates a resolver that trusts header when set by proxies in the given networks.
+// Without any, forwarding headers are ignored and the client is the peer address.
+func New(trusted []netip.Prefix, header cfg.ProxyHeader) *Resolver {
+	return &Resolver{trusted: trusted, header: header}
+}
+
+// Middleware stores the client address in the request context, install it before logger.Http
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithIP(r.Context(), res.Resolve(r))))
+	})
+}
+
+// Resolve returns the client address of r
+func (res *Resolver) Resolve(r *http.Request) string {
+	remote := peer(r)
+	addr, err := parseAddr(remote)
+	if err != nil {
+		return remote
+	}
+	if !res.isTrusted(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	switch res.header {
+	case cfg.ProxyHeaderForwarded:
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	case cfg.ProxyHeaderXForwardedFor:
+		hops = splitList(r.Header.Values("X-Forwarded-For"))
+	case cfg.ProxyHeaderXRealIP:
+		if v := r.Header.Get("X-Real-IP"); v != "" {
+			hops = []string{strings.TrimSpace(v)}
+		}
+	}
+
+	// walk from the proxy closest to us towards the client
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseAddr(hops[i])
+		if err != nil {
+			// "unknown", obfuscated or garbage, the last address we could read is as far as we get
+			break
+		}
+		client = hop
+		if !res.isTrusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peer is the address of the host that opened the connection
+func peer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err == nil && host != "" {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// parseAddr reads an address that may be quoted, bracketed or carry a port
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		ap, apErr := netip.ParseAddrPort(s)
+		if apErr != nil {
+			return netip.Addr{}, err
+		}
+		addr = ap.Addr()
+	}
+	// IPv4 clients of a dual stack listener show up as ::ffff:a.b.c.d
+	return addr.Unmap().WithZone(""), nil
+}
+
+// splitList joins repeated header lines and splits them at commas
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			out = append(out, strings.TrimSpace(part))
+		}
+	}
+	return out
+}
+
+// forwardedFor returns the for= parameter of every element of RFC 7239 Forwarded headers,
+// elements without one are kept as "" so they stop the walk like any unreadable hop
+func forwardedFor(values []string) []string {
+	var out []string
+	for _, element := range splitList(values) {
+		var hop string
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+				hop = strings.TrimSpace(value)
+			}
+		}
+		out = append(out, hop)
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+func TestResolve(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+
+	tests := []struct {
+		name   string
+		proxy  cfg.ProxyHeader // defaults to x-forwarded-for
+		remote string
+		header http.Header
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.9:5123", want: "203.0.113.9"},
+		{name: "untrusted peer can't forward", remote: "203.0.113.9:5123",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "203.0.113.9"},
+		{name: "mapped ipv4 peer", remote: "[::ffff:203.0.113.9]:5123", want: "203.0.113.9"},
+		{name: "trusted proxy without headers", remote: "10.0.0.2:80", want: "10.0.0.2"},
+		{name: "x-forwarded-for", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "forged left-most entry", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.7"}}, want: "198.51.100.1"},
+		{name: "repeated header lines", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1, 10.0.0.7"}}, want: "198.51.100.1"},
+		{name: "entries with ports", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"[2001:db8::1]:4711, 10.0.0.7:443"}}, want: "2001:db8::1"},
+		{name: "only trusted hops", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"10.1.1.1, 10.0.0.7"}}, want: "10.1.1.1"},
+		{name: "garbage stops at the last readable hop", remote: "10.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, nonsense, 10.0.0.7"}}, want: "10.0.0.7"},
+		{name: "x-real-ip", proxy: cfg.ProxyHeaderXRealIP, remote: "10.0.0.2:80",
+			header: http.Header{"X-Real-Ip": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "forwarded", proxy: cfg.ProxyHeaderForwarded, remote: "10.0.0.2:80",
+			header: http.Header{"Forwarded": {`for=1.1.1.1, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.7;by=10.0.0.2`}},
+			want:   "2001:db8:cafe::17"},
+		{name: "spoofed forwarded is ignored", remote: "10.0.0.2:80",
+			header: http.Header{"Forwarded": {"For=1.1.1.1"}, "X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "spoofed x-real-ip is ignored", remote: "10.0.0.2:80",
+			header: http.Header{"X-Real-Ip": {"1.1.1.1"}}, want: "10.0.0.2"},
+		{name: "spoofed x-forwarded-for is ignored", proxy: cfg.ProxyHeaderForwarded, remote: "10.0.0.2:80",
+			header: http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"1.1.1.1"}}, want: "198.51.100.1"},
+		{name: "forwarded unknown", proxy: cfg.ProxyHeaderForwarded, remote: "10.0.0.2:80",
+			header: http.Header{"Forwarded": {"for=unknown, for=10.0.0.7"}}, want: "10.0.0.7"},
+		{name: "forwarded obfuscated", proxy: cfg.ProxyHeaderForwarded, remote: "10.0.0.2:80",
+			header: http.Header{"Forwarded": {`for="_hidden";proto=https`}}, want: "10.0.0.2"},
+		{name: "trusted ipv6 proxy", remote: "[2001:db8:ffff::1]:443",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			proxy := tt.proxy
+			if proxy == "" {
+				proxy = cfg.ProxyHeaderXForwardedFor
+			}
+			if got := New(trusted, proxy).Resolve(req); got != tt.want {
+				t.Errorf("Resolve = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	res := New([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, cfg.ProxyHeaderXForwardedFor)
+
+	var got string
+	h := res.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "198.51.100.1" {
+		t.Errorf("FromRequest = %q, want the forwarded client", got)
+	}
+
+	// without the middleware the peer is used
+	if ip := FromRequest(req); ip != "127.0.0.1" {
+		t.Errorf("FromRequest without middleware = %q, want the peer", ip)
+	}
+}
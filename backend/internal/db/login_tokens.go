@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrLoginTokenInvalid is returned when a login token is unknown, expired or already used
+var ErrLoginTokenInvalid = errors.New("login token is invalid or expired")
+
+// CreateLoginToken stores the hash of a single-use login token for email
+func (db *PostgresDB) CreateLoginToken(ctx context.Context, email, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO login_tokens (email, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	if _, err := db.Pool.Exec(ctx, query, email, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("email", email).Time("expires_at", expiresAt).Msg("login token created")
+	return nil
+}
+
+// ConsumeLoginToken marks the token as used and returns the email it was issued for.
+// The update is atomic, so a token can only ever be consumed once.
+func (db *PostgresDB) ConsumeLoginToken(ctx context.Context, tokenHash string) (string, error) {
+	query := `
+		UPDATE login_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING email
+	`
+
+	var email string
+	err := db.Pool.QueryRow(ctx, query, tokenHash).Scan(&email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrLoginTokenInvalid
+		}
+		return "", err
+	}
+
+	// invalidate any other outstanding tokens for the same address
+	if _, err := db.Pool.Exec(ctx,
+		"UPDATE login_tokens SET used_at = NOW() WHERE email = $1 AND used_at IS NULL", email,
+	); err != nil {
+		db.Logger.Warn().Err(err).Str("email", email).Msg("failed to invalidate outstanding login tokens")
+	}
+
+	db.Logger.Debug().Str("email", email).Msg("login token consumed")
+	return email, nil
+}
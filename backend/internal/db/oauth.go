@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrOAuthClientNotFound is returned when no client matches the client_id
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrOAuthCodeInvalid is returned when an authorization code is unknown, expired or already used
+	ErrOAuthCodeInvalid = errors.New("authorization code is invalid or expired")
+)
+
+// GetOAuthClient retrieves a registered client by its client_id
+func (db *PostgresDB) GetOAuthClient(ctx context.Context, id string) (*models.OAuthClient, error) {
+	query := `
+		SELECT id, name, COALESCE(secret_hash, ''), redirect_uris, scopes,
+			   EXTRACT(EPOCH FROM created_at)::bigint as created_at,
+			   EXTRACT(EPOCH FROM updated_at)::bigint as updated_at
+		FROM oauth_clients
+		WHERE id = $1
+	`
+
+	var client models.OAuthClient
+	err := db.Pool.QueryRow(ctx, query, id).Scan(
+		&client.Id,
+		&client.Name,
+		&client.SecretHash,
+		&client.RedirectURIs,
+		&client.Scopes,
+		&client.CreatedAt,
+		&client.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// CreateOAuthClient registers a new client, SecretHash must already be hashed
+func (db *PostgresDB) CreateOAuthClient(ctx context.Context, client models.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+	`
+
+	if _, err := db.Pool.Exec(ctx, query,
+		client.Id, client.Name, client.SecretHash, client.RedirectURIs, client.Scopes,
+	); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("client_id", client.Id).Msg("oauth client created")
+	return nil
+}
+
+// GetOAuthConsent returns the scopes the user granted to the client, nil if never consented
+func (db *PostgresDB) GetOAuthConsent(ctx context.Context, userID uuid.UUID, clientID string) ([]string, error) {
+	query := "SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2"
+
+	var scopes []string
+	err := db.Pool.QueryRow(ctx, query, userID, clientID).Scan(&scopes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return scopes, nil
+}
+
+// SaveOAuthConsent records the scopes the user granted to the client, replacing earlier consent
+func (db *PostgresDB) SaveOAuthConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id)
+		DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = NOW()
+	`
+
+	if _, err := db.Pool.Exec(ctx, query, userID, clientID, scopes); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("user_id", userID.String()).Str("client_id", clientID).Strs("scopes", scopes).Msg("oauth consent saved")
+	return nil
+}
+
+// CreateOAuthCode stores an issued authorization code
+func (db *PostgresDB) CreateOAuthCode(ctx context.Context, code models.OAuthCode) error {
+	query := `
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := db.Pool.Exec(ctx, query,
+		code.CodeHash,
+		code.ClientId,
+		code.UserId,
+		code.RedirectURI,
+		code.Scopes,
+		code.Nonce,
+		code.CodeChallenge,
+		code.AuthTime,
+		code.ExpiresAt,
+	)
+	return err
+}
+
+// ConsumeOAuthCode marks the code as used and returns it. The update is atomic,
+// so a code can only be exchanged once.
+func (db *PostgresDB) ConsumeOAuthCode(ctx context.Context, codeHash string) (*models.OAuthCode, error) {
+	query := `
+		UPDATE oauth_codes SET used_at = NOW()
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at
+	`
+
+	var code models.OAuthCode
+	err := db.Pool.QueryRow(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientId,
+		&code.UserId,
+		&code.RedirectURI,
+		&code.Scopes,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.AuthTime,
+		&code.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOAuthCodeInvalid
+		}
+		return nil, err
+	}
+	return &code, nil
+}
@@ -2,15 +2,20 @@ package db
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	cfg "github.com/anish-chanda/go-app-starter/internal/config"
 	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
 )
 
+// ErrUserNotFound is returned when no user matches the lookup
+var ErrUserNotFound = errors.New("user not found")
+
 type PostgresDB struct {
 	Pool   *pgxpool.Pool
 	Logger *zerolog.Logger
@@ -19,6 +24,21 @@ type PostgresDB struct {
 // NewPosgresDb create a new connection pool and pings the database
 
 func NewPostgresDb(cfg cfg.DbConfig, ctx context.Context, logger *zerolog.Logger) (*PostgresDB, error) {
+	db, err := New(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// ping database
+	if err := db.Pool.Ping(ctx); err != nil {
+		db.Pool.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// New creates the connection pool without connecting, connections are opened on first use
+func New(cfg cfg.DbConfig, logger *zerolog.Logger) (*PostgresDB, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
 	if err != nil {
 		return nil, err
@@ -30,17 +50,11 @@ func NewPostgresDb(cfg cfg.DbConfig, ctx context.Context, logger *zerolog.Logger
 	poolConfig.MaxConnLifetime = time.Duration(cfg.MaxConnLifetime) * time.Minute
 
 	// create pool
-	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// ping database
-	if err := pool.Ping(ctx); err != nil {
-		pool.Close()
-		return nil, err
-	}
-
 	// create logger with service context
 	dbLogger := logger.With().Str("service", "db").Logger()
 
@@ -61,11 +75,20 @@ func (db *PostgresDB) EmailExists(ctx context.Context, email string) (bool, erro
 	return exists, nil
 }
 
+// queryRower is implemented by the pool and by transactions
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func (db *PostgresDB) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	return db.createUser(ctx, db.Pool, user)
+}
+
+func (db *PostgresDB) createUser(ctx context.Context, q queryRower, user models.User) (*models.User, error) {
 	query := `
-		INSERT INTO users (name, email, password_hash, auth_provider, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		RETURNING id, name, email, password_hash, auth_provider, 
+		INSERT INTO users (name, email, email_verified, password_hash, auth_provider, organization_id, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NOW(), NOW())
+		RETURNING id, COALESCE(name, ''), email, email_verified, COALESCE(password_hash, ''), auth_provider, organization_id, is_admin,
 				  EXTRACT(EPOCH FROM created_at)::bigint as created_at,
 				  EXTRACT(EPOCH FROM updated_at)::bigint as updated_at
 	`
@@ -73,17 +96,22 @@ func (db *PostgresDB) CreateUser(ctx context.Context, user models.User) (*models
 	db.Logger.Debug().Str("email", user.Email).Str("auth_provider", string(user.AuthProvider)).Msg("creating new user")
 
 	var createdUser models.User
-	err := db.Pool.QueryRow(ctx, query,
+	err := q.QueryRow(ctx, query,
 		user.Name,
 		user.Email,
+		user.EmailVerified,
 		user.PasswordHash,
 		user.AuthProvider,
+		user.OrganizationId,
 	).Scan(
 		&createdUser.Id,
 		&createdUser.Name,
 		&createdUser.Email,
+		&createdUser.EmailVerified,
 		&createdUser.PasswordHash,
 		&createdUser.AuthProvider,
+		&createdUser.OrganizationId,
+		&createdUser.IsAdmin,
 		&createdUser.CreatedAt,
 		&createdUser.UpdatedAt,
 	)
@@ -99,7 +127,7 @@ func (db *PostgresDB) CreateUser(ctx context.Context, user models.User) (*models
 // GetUserByEmail retrieves a user by email address
 func (db *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, name, email, password_hash, auth_provider,
+		SELECT id, COALESCE(name, ''), email, email_verified, COALESCE(password_hash, ''), auth_provider, organization_id, is_admin,
 			   EXTRACT(EPOCH FROM created_at)::bigint as created_at,
 			   EXTRACT(EPOCH FROM updated_at)::bigint as updated_at
 		FROM users 
@@ -113,16 +141,19 @@ func (db *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*models
 		&user.Id,
 		&user.Name,
 		&user.Email,
+		&user.EmailVerified,
 		&user.PasswordHash,
 		&user.AuthProvider,
+		&user.OrganizationId,
+		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 
 	if err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			db.Logger.Debug().Str("email", email).Msg("user not found")
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		db.Logger.Debug().Err(err).Str("email", email).Msg("failed to retrieve user")
 		return nil, err
@@ -131,3 +162,93 @@ func (db *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*models
 	db.Logger.Debug().Str("user_id", user.Id.String()).Str("email", email).Msg("user retrieved successfully")
 	return &user, nil
 }
+
+// GetUserByID retrieves a user by id
+func (db *PostgresDB) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	query := `
+		SELECT id, COALESCE(name, ''), email, email_verified, COALESCE(password_hash, ''), auth_provider, organization_id, is_admin,
+			   EXTRACT(EPOCH FROM created_at)::bigint as created_at,
+			   EXTRACT(EPOCH FROM updated_at)::bigint as updated_at
+		FROM users
+		WHERE id = $1
+	`
+
+	var user models.User
+	err := db.Pool.QueryRow(ctx, query, id).Scan(
+		&user.Id,
+		&user.Name,
+		&user.Email,
+		&user.EmailVerified,
+		&user.PasswordHash,
+		&user.AuthProvider,
+		&user.OrganizationId,
+		&user.IsAdmin,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// MarkEmailVerified flags the user's email address as verified
+func (db *PostgresDB) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	query := "UPDATE users SET email_verified = TRUE, updated_at = NOW() WHERE id = $1 AND NOT email_verified"
+
+	if _, err := db.Pool.Exec(ctx, query, id); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("user_id", id.String()).Msg("email marked as verified")
+	return nil
+}
+
+// SetUserOrganization links an existing user to an organization
+func (db *PostgresDB) SetUserOrganization(ctx context.Context, userID, orgID uuid.UUID) error {
+	query := "UPDATE users SET organization_id = $2, updated_at = NOW() WHERE id = $1"
+
+	if _, err := db.Pool.Exec(ctx, query, userID, orgID); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("user_id", userID.String()).Str("organization_id", orgID.String()).Msg("user linked to organization")
+	return nil
+}
+
+// SetUserPassword replaces the password hash of the user
+func (db *PostgresDB) SetUserPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := "UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1"
+
+	tag, err := db.Pool.Exec(ctx, query, id, passwordHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	db.Logger.Debug().Str("user_id", id.String()).Msg("password changed")
+	return nil
+}
+
+// SetUserAdmin grants or revokes admin rights, they show up in the next session token
+func (db *PostgresDB) SetUserAdmin(ctx context.Context, id uuid.UUID, admin bool) error {
+	query := "UPDATE users SET is_admin = $2, updated_at = NOW() WHERE id = $1"
+
+	tag, err := db.Pool.Exec(ctx, query, id, admin)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	db.Logger.Debug().Str("user_id", id.String()).Bool("admin", admin).Msg("admin rights changed")
+	return nil
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/models"
+)
+
+// UpdateRateLimit passes the state of key to fn and stores the result until expiresAt.
+// The row is locked for the transaction, so concurrent requests for a key are counted one by one.
+func (db *PostgresDB) UpdateRateLimit(ctx context.Context, key string, expiresAt time.Time, fn func(models.RateLimitState) models.RateLimitState) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// the no-op update locks an existing row, a new key is inserted and locked in the same statement
+	query := `
+		INSERT INTO rate_limits (key, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING value, prev, at, expires_at > NOW()
+	`
+
+	var (
+		state models.RateLimitState
+		at    *time.Time
+		live  bool
+	)
+	if err := tx.QueryRow(ctx, query, key, expiresAt).Scan(&state.Value, &state.Prev, &at, &live); err != nil {
+		return err
+	}
+	if at != nil && live {
+		state.At = *at
+	} else {
+		// an expired key starts over
+		state = models.RateLimitState{}
+	}
+
+	next := fn(state)
+	if _, err := tx.Exec(ctx,
+		"UPDATE rate_limits SET value = $2, prev = $3, at = $4, expires_at = $5 WHERE key = $1",
+		key, next.Value, next.Prev, next.At, expiresAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteExpiredRateLimits removes keys that have been idle past their expiry
+func (db *PostgresDB) DeleteExpiredRateLimits(ctx context.Context) (int64, error) {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM rate_limits WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
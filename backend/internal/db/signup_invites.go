@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSignupInviteInvalid is returned when no unused, unexpired invite matches
+var ErrSignupInviteInvalid = errors.New("invite is invalid or expired")
+
+// CreateSignupInvite stores the hash of an invite token for email
+func (db *PostgresDB) CreateSignupInvite(ctx context.Context, email, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO signup_invites (email, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	if _, err := db.Pool.Exec(ctx, query, email, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("email", email).Time("expires_at", expiresAt).Msg("signup invite created")
+	return nil
+}
+
+// HasSignupInvite reports whether email has an outstanding invite
+func (db *PostgresDB) HasSignupInvite(ctx context.Context, email string) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM signup_invites WHERE email = $1 AND used_at IS NULL AND expires_at > NOW())"
+
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, query, email).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// CreateInvitedUser consumes an invite for user.Email and creates the user in one
+// transaction, so an invite is only used up by an account that exists. With a tokenHash
+// the invite must match it, without one any outstanding invite for the address is
+// consumed, which is only allowed when the provider verified that the user owns it.
+func (db *PostgresDB) CreateInvitedUser(ctx context.Context, user models.User, tokenHash string) (*models.User, error) {
+	if tokenHash == "" && !user.EmailVerified {
+		return nil, ErrSignupInviteInvalid
+	}
+
+	var created *models.User
+	err := pgx.BeginFunc(ctx, db.Pool, func(tx pgx.Tx) error {
+		query := `
+			UPDATE signup_invites SET used_at = NOW()
+			WHERE email = $1 AND ($2 = '' OR token_hash = $2) AND used_at IS NULL AND expires_at > NOW()
+		`
+		tag, err := tx.Exec(ctx, query, user.Email, tokenHash)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrSignupInviteInvalid
+		}
+
+		created, err = db.createUser(ctx, tx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.Logger.Debug().Str("email", user.Email).Msg("signup invite consumed")
+	return created, nil
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrSSOConnectionNotFound is returned when no enabled identity provider matches
+	ErrSSOConnectionNotFound = errors.New("sso connection not found")
+	// ErrSSOStateInvalid is returned when a login state is unknown, expired or already used
+	ErrSSOStateInvalid = errors.New("sso login state is invalid or expired")
+)
+
+const ssoConnectionColumns = `
+	c.id, c.organization_id, c.protocol, c.enabled,
+	COALESCE(c.oidc_issuer, ''), COALESCE(c.oidc_client_id, ''), COALESCE(c.oidc_client_secret, ''),
+	COALESCE(c.saml_idp_metadata, ''),
+	EXTRACT(EPOCH FROM c.created_at)::bigint as created_at,
+	EXTRACT(EPOCH FROM c.updated_at)::bigint as updated_at
+`
+
+func scanSSOConnection(row pgx.Row) (*models.SSOConnection, error) {
+	var conn models.SSOConnection
+	err := row.Scan(
+		&conn.Id,
+		&conn.OrganizationId,
+		&conn.Protocol,
+		&conn.Enabled,
+		&conn.OIDCIssuer,
+		&conn.OIDCClientId,
+		&conn.OIDCClientSecret,
+		&conn.SAMLIDPMetadata,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSSOConnectionNotFound
+		}
+		return nil, err
+	}
+	return &conn, nil
+}
+
+// CreateOrganization creates a new organization
+func (db *PostgresDB) CreateOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	query := `
+		INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id, name,
+				  EXTRACT(EPOCH FROM created_at)::bigint as created_at,
+				  EXTRACT(EPOCH FROM updated_at)::bigint as updated_at
+	`
+
+	var org models.Organization
+	if err := db.Pool.QueryRow(ctx, query, name).Scan(&org.Id, &org.Name, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	db.Logger.Debug().Str("organization_id", org.Id.String()).Msg("organization created")
+	return &org, nil
+}
+
+// CreateSSOConnection stores the identity provider of an organization
+func (db *PostgresDB) CreateSSOConnection(ctx context.Context, conn models.SSOConnection) (*models.SSOConnection, error) {
+	query := `
+		INSERT INTO sso_connections AS c (organization_id, protocol, enabled, oidc_issuer, oidc_client_id,
+			oidc_client_secret, saml_idp_metadata)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''))
+		RETURNING ` + ssoConnectionColumns
+
+	created, err := scanSSOConnection(db.Pool.QueryRow(ctx, query,
+		conn.OrganizationId,
+		conn.Protocol,
+		conn.Enabled,
+		conn.OIDCIssuer,
+		conn.OIDCClientId,
+		conn.OIDCClientSecret,
+		conn.SAMLIDPMetadata,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	db.Logger.Debug().Str("connection_id", created.Id.String()).Str("protocol", string(created.Protocol)).Msg("sso connection created")
+	return created, nil
+}
+
+// AddSSODomain routes logins for an email domain to the organization's identity provider
+func (db *PostgresDB) AddSSODomain(ctx context.Context, domain string, orgID uuid.UUID) error {
+	query := "INSERT INTO sso_domains (domain, organization_id) VALUES (LOWER($1), $2)"
+
+	if _, err := db.Pool.Exec(ctx, query, domain, orgID); err != nil {
+		return err
+	}
+
+	db.Logger.Debug().Str("domain", domain).Str("organization_id", orgID.String()).Msg("sso domain added")
+	return nil
+}
+
+// GetSSOConnection retrieves an enabled connection by id
+func (db *PostgresDB) GetSSOConnection(ctx context.Context, id uuid.UUID) (*models.SSOConnection, error) {
+	query := "SELECT " + ssoConnectionColumns + " FROM sso_connections c WHERE c.id = $1 AND c.enabled"
+
+	return scanSSOConnection(db.Pool.QueryRow(ctx, query, id))
+}
+
+// GetSSOConnectionByDomain retrieves the enabled connection for an email domain
+func (db *PostgresDB) GetSSOConnectionByDomain(ctx context.Context, domain string) (*models.SSOConnection, error) {
+	query := "SELECT " + ssoConnectionColumns + `
+		FROM sso_domains d
+		JOIN sso_connections c ON c.organization_id = d.organization_id
+		WHERE d.domain = LOWER($1) AND c.enabled
+	`
+
+	db.Logger.Debug().Str("domain", domain).Msg("looking up sso connection for domain")
+	return scanSSOConnection(db.Pool.QueryRow(ctx, query, domain))
+}
+
+// CreateSSOLoginState stores a pending sso login
+func (db *PostgresDB) CreateSSOLoginState(ctx context.Context, state models.SSOLoginState) error {
+	query := `
+		INSERT INTO sso_login_states (state_hash, connection_id, nonce, code_verifier, request_id, audience, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := db.Pool.Exec(ctx, query,
+		state.StateHash,
+		state.ConnectionId,
+		state.Nonce,
+		state.CodeVerifier,
+		state.RequestId,
+		state.Audience,
+		state.ExpiresAt,
+	)
+	return err
+}
+
+// ConsumeSSOLoginState marks the state as used and returns it. The update is atomic,
+// so an IdP response can only complete a login once.
+func (db *PostgresDB) ConsumeSSOLoginState(ctx context.Context, stateHash string) (*models.SSOLoginState, error) {
+	query := `
+		UPDATE sso_login_states SET used_at = NOW()
+		WHERE state_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING state_hash, connection_id, nonce, code_verifier, request_id, audience, expires_at
+	`
+
+	var state models.SSOLoginState
+	err := db.Pool.QueryRow(ctx, query, stateHash).Scan(
+		&state.StateHash,
+		&state.ConnectionId,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.RequestId,
+		&state.Audience,
+		&state.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSSOStateInvalid
+		}
+		return nil, err
+	}
+	return &state, nil
+}
@@ -6,14 +6,21 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	"github.com/anish-chanda/go-app-starter/internal/db"
 	"github.com/anish-chanda/go-app-starter/internal/logger"
 	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/anish-chanda/go-app-starter/internal/signup"
 	"github.com/go-pkgz/auth/v2/token"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -26,9 +33,19 @@ const (
 	argonKeyLen  = 32
 )
 
-// hashPassword applies Argon2id with OWASP‐recommended params and returns
+// problem codes returned by the auth handlers
+const (
+	codeEmailExists      = "email_exists"
+	codeSignupClosed     = "signup_closed"
+	codeInviteRequired   = "invite_required"
+	codeInviteInvalid    = "invite_invalid"
+	codeDomainNotAllowed = "domain_not_allowed"
+	codeDisposableEmail  = "disposable_email"
+)
+
+// HashPassword applies Argon2id with OWASP‐recommended params and returns
 // a single string in the standard “$argon2id$v=19$m=…,t=…,p=…$salt$hash” format.
-func hashPassword(password string) (string, error) {
+func HashPassword(password string) (string, error) {
 	salt := make([]byte, argonSaltLen)
 	if _, err := rand.Read(salt); err != nil {
 		return "", err
@@ -83,14 +100,23 @@ func verifyPassword(password, encoded string) (bool, error) {
 
 // Request and response structs
 type SignupRequest struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,max=255"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+	Invite   string `json:"invite,omitempty"` // required when SIGNUP_MODE=invite
 }
 
+type SignupResponse struct {
+	Id       uuid.UUID           `json:"id"`
+	Email    string              `json:"email"`
+	Provider models.AuthProvider `json:"provider"`
+}
+
+// LoginRequest is the body accepted by the go-pkgz local provider at POST /auth/local/login
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	User     string `json:"user"`
+	Password string `json:"passwd"`
+	Audience string `json:"aud,omitempty"`
 }
 
 func (h *Handler) SignupHandler(w http.ResponseWriter, r *http.Request) {
@@ -98,13 +124,9 @@ func (h *Handler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	log := logger.Ctx(ctx)
 
 	// Parse request
-	var req SignupRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
-		return
-	}
-	if err := ValidateSignupRequest(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	req, err := request.Decode[SignupRequest](w, r)
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
@@ -113,21 +135,30 @@ func (h *Handler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if email exists
 	exists, err := h.DB.EmailExists(ctx, email)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to check email existence")
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(fmt.Errorf("check email existence: %w", err)))
 		return
 	}
 	if exists {
 		log.Info().Str("email", email).Msg("signup attempt with existing email")
-		http.Error(w, "email already exists", http.StatusConflict)
+		apperr.Write(w, r, apperr.Conflict(codeEmailExists, "email already exists"))
+		return
+	}
+
+	// the email is not verified yet, so an invite has to be proven with its token
+	if err := h.CheckSignup(ctx, email, req.Invite, false); err != nil {
+		if denied := signupDenied(err); denied != nil {
+			log.Info().Str("email", email).Err(err).Msg("signup rejected by policy")
+			apperr.Write(w, r, denied)
+			return
+		}
+		apperr.Write(w, r, apperr.Internal(fmt.Errorf("check signup policy: %w", err)))
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := hashPassword(req.Password)
+	hashedPassword, err := HashPassword(req.Password)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to hash password")
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(fmt.Errorf("hash password: %w", err)))
 		return
 	}
 
@@ -139,20 +170,24 @@ func (h *Handler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 		AuthProvider: models.AuthProviderLocal,
 	}
 
-	createdUser, err := h.DB.CreateUser(ctx, user)
+	createdUser, err := h.CreateSignupUser(ctx, user, req.Invite)
 	if err != nil {
-		log.Error().Err(err).Str("email", email).Msg("failed to create user")
-		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		if denied := signupDenied(err); denied != nil {
+			log.Info().Str("email", email).Err(err).Msg("signup rejected by policy")
+			apperr.Write(w, r, denied)
+			return
+		}
+		apperr.Write(w, r, apperr.Internal(fmt.Errorf("create user %s: %w", email, err)))
 		return
 	}
 
 	log.Info().Str("user_id", createdUser.Id.String()).Str("email", email).Msg("user created successfully")
 
 	// Return success response (excluding sensitive data like password hash)
-	response := map[string]interface{}{
-		"id":       createdUser.Id,
-		"email":    createdUser.Email,
-		"provider": createdUser.AuthProvider,
+	response := SignupResponse{
+		Id:       createdUser.Id,
+		Email:    createdUser.Email,
+		Provider: createdUser.AuthProvider,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -160,25 +195,60 @@ func (h *Handler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func ValidateSignupRequest(req *SignupRequest) error {
-	// password cannot be empty
-	if strings.TrimSpace(req.Password) == "" {
-		return fmt.Errorf("password cannot be empty")
+// CheckSignup enforces the signup policy before a new account is created for email.
+// In invite mode an invite has to be presented by its token, or when the provider
+// verified the email (magic link), be outstanding for the address. The invite is only
+// consumed by CreateSignupUser, so a failed signup doesn't use it up.
+// Every code path that creates users on first login must call both.
+func (h *Handler) CheckSignup(ctx context.Context, email, invite string, emailVerified bool) error {
+	if err := h.Signup.CheckEmail(email); err != nil {
+		return err
 	}
-	// email cannot be empty
-	if strings.TrimSpace(req.Email) == "" {
-		return fmt.Errorf("email cannot be empty")
+	if !h.Signup.InviteRequired() || invite != "" {
+		return nil
 	}
-	// name cannot be empty for local auth
-	if strings.TrimSpace(req.Name) == "" {
-		return fmt.Errorf("name cannot be empty")
+	if !emailVerified {
+		return signup.ErrInviteRequired
 	}
-	// name length validation
-	if len(strings.TrimSpace(req.Name)) > 255 {
-		return fmt.Errorf("name must be less than 255 characters")
+
+	ok, err := h.DB.HasSignupInvite(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return signup.ErrInviteRequired
+	}
+	return nil
+}
+
+// CreateSignupUser creates a user that passed CheckSignup. In invite mode the invite is
+// consumed in the same transaction that inserts the user.
+func (h *Handler) CreateSignupUser(ctx context.Context, user models.User, invite string) (*models.User, error) {
+	if !h.Signup.InviteRequired() {
+		return h.DB.CreateUser(ctx, user)
+	}
+
+	var tokenHash string
+	if invite != "" {
+		tokenHash = authutil.HashToken(invite)
 	}
+	return h.DB.CreateInvitedUser(ctx, user, tokenHash)
+}
 
-	// Note: other validations cna be added here absed on your requirements
+// signupDenied maps a signup refused by policy to its client error, other errors return nil
+func signupDenied(err error) *apperr.Error {
+	switch {
+	case errors.Is(err, signup.ErrClosed):
+		return apperr.Forbidden(codeSignupClosed, err.Error())
+	case errors.Is(err, signup.ErrInviteRequired):
+		return apperr.Forbidden(codeInviteRequired, err.Error())
+	case errors.Is(err, db.ErrSignupInviteInvalid):
+		return apperr.Forbidden(codeInviteInvalid, err.Error())
+	case errors.Is(err, signup.ErrDomainNotAllowed):
+		return apperr.Forbidden(codeDomainNotAllowed, err.Error())
+	case errors.Is(err, signup.ErrDisposableEmail):
+		return apperr.Forbidden(codeDisposableEmail, err.Error())
+	}
 	return nil
 }
 
@@ -272,9 +342,10 @@ func (h *Handler) ClaimsUpdater() func(claims token.Claims) token.Claims {
 			// Always set email
 			claims.User.Email = dbUser.Email
 
-			// For local provider, overwrite Name with display name from DB
+			// For local, email and sso providers, overwrite Name with display name from DB
 			// For OAuth2 providers (google, github, etc.), keep the name from provider
-			if dbUser.AuthProvider == models.AuthProviderLocal {
+			if dbUser.AuthProvider == models.AuthProviderLocal || dbUser.AuthProvider == models.AuthProviderEmail ||
+				dbUser.AuthProvider == models.AuthProviderSSO {
 				claims.User.Name = dbUser.Name
 			}
 
@@ -282,6 +353,9 @@ func (h *Handler) ClaimsUpdater() func(claims token.Claims) token.Claims {
 			claims.User.SetStrAttr("uid", dbUser.Id.String())
 			// Always store auth provider as an attribute for frontend display
 			claims.User.SetStrAttr("provider", string(dbUser.AuthProvider))
+			if dbUser.IsAdmin {
+				claims.User.SetAdmin(true)
+			}
 		}
 
 		return claims
@@ -3,6 +3,9 @@ package handlers
 import (
 	"strings"
 	"testing"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/request"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -19,7 +22,7 @@ func TestHashPassword(t *testing.T) {
 		{
 			name:     "empty password",
 			password: "",
-			wantErr:  false, // hashPassword should handle empty strings
+			wantErr:  false, // HashPassword should handle empty strings
 		},
 		{
 			name:     "long password",
@@ -40,28 +43,28 @@ func TestHashPassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hash, err := hashPassword(tt.password)
+			hash, err := HashPassword(tt.password)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("hashPassword() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("HashPassword() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if !tt.wantErr {
 				// Verify hash format
 				if !strings.HasPrefix(hash, "$argon2id$") {
-					t.Errorf("hashPassword() = %v, expected hash to start with $argon2id$", hash)
+					t.Errorf("HashPassword() = %v, expected hash to start with $argon2id$", hash)
 				}
 
 				// Verify hash has correct number of fields
 				fields := strings.Split(hash, "$")
 				if len(fields) != 6 {
-					t.Errorf("hashPassword() = %v, expected hash to have 6 fields, got %d", hash, len(fields))
+					t.Errorf("HashPassword() = %v, expected hash to have 6 fields, got %d", hash, len(fields))
 				}
 
 				// Verify hash is not empty
 				if hash == "" {
-					t.Errorf("hashPassword() returned empty hash")
+					t.Errorf("HashPassword() returned empty hash")
 				}
 			}
 		})
@@ -71,26 +74,26 @@ func TestHashPassword(t *testing.T) {
 func TestHashPasswordUniqueness(t *testing.T) {
 	password := "testPassword123"
 
-	hash1, err1 := hashPassword(password)
+	hash1, err1 := HashPassword(password)
 	if err1 != nil {
-		t.Fatalf("hashPassword() error = %v", err1)
+		t.Fatalf("HashPassword() error = %v", err1)
 	}
 
-	hash2, err2 := hashPassword(password)
+	hash2, err2 := HashPassword(password)
 	if err2 != nil {
-		t.Fatalf("hashPassword() error = %v", err2)
+		t.Fatalf("HashPassword() error = %v", err2)
 	}
 
 	// Hashes should be different due to different salts
 	if hash1 == hash2 {
-		t.Errorf("hashPassword() produced identical hashes for same password: %s", hash1)
+		t.Errorf("HashPassword() produced identical hashes for same password: %s", hash1)
 	}
 }
 
 func TestVerifyPassword(t *testing.T) {
 	// Generate a test hash first
 	testPassword := "testPassword123"
-	testHash, err := hashPassword(testPassword)
+	testHash, err := HashPassword(testPassword)
 	if err != nil {
 		t.Fatalf("Failed to generate test hash: %v", err)
 	}
@@ -194,9 +197,9 @@ func TestVerifyPasswordWithDifferentPasswords(t *testing.T) {
 
 	for _, password := range passwords {
 		t.Run("password_"+password, func(t *testing.T) {
-			hash, err := hashPassword(password)
+			hash, err := HashPassword(password)
 			if err != nil {
-				t.Fatalf("hashPassword() error = %v", err)
+				t.Fatalf("HashPassword() error = %v", err)
 			}
 
 			// Verify correct password
@@ -245,18 +248,18 @@ func BenchmarkHashPassword(b *testing.B) {
 	password := "testPassword123"
 
 	for i := 0; i < b.N; i++ {
-		_, err := hashPassword(password)
+		_, err := HashPassword(password)
 		if err != nil {
-			b.Fatalf("hashPassword() error = %v", err)
+			b.Fatalf("HashPassword() error = %v", err)
 		}
 	}
 }
 
 func BenchmarkVerifyPassword(b *testing.B) {
 	password := "testPassword123"
-	hash, err := hashPassword(password)
+	hash, err := HashPassword(password)
 	if err != nil {
-		b.Fatalf("hashPassword() error = %v", err)
+		b.Fatalf("HashPassword() error = %v", err)
 	}
 
 	b.ResetTimer()
@@ -267,3 +270,66 @@ func BenchmarkVerifyPassword(b *testing.B) {
 		}
 	}
 }
+
+func TestSignupRequestValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     SignupRequest
+		wantErr string
+	}{
+		{
+			name: "valid request",
+			req:  SignupRequest{Name: "Test", Email: "Test@Example.com", Password: "secret"},
+		},
+		{
+			name:    "empty email",
+			req:     SignupRequest{Name: "Test", Email: " ", Password: "secret"},
+			wantErr: "email cannot be empty",
+		},
+		{
+			name:    "missing domain",
+			req:     SignupRequest{Name: "Test", Email: "test@", Password: "secret"},
+			wantErr: "invalid email address",
+		},
+		{
+			name:    "display name form",
+			req:     SignupRequest{Name: "Test", Email: "Test <test@example.com>", Password: "secret"},
+			wantErr: "invalid email address",
+		},
+		{
+			name:    "two addresses",
+			req:     SignupRequest{Name: "Test", Email: "a@example.com,b@example.com", Password: "secret"},
+			wantErr: "invalid email address",
+		},
+		{
+			name:    "empty name",
+			req:     SignupRequest{Email: "test@example.com", Password: "secret"},
+			wantErr: "name cannot be empty",
+		},
+		{
+			name:    "name too long",
+			req:     SignupRequest{Name: strings.Repeat("a", 256), Email: "test@example.com", Password: "secret"},
+			wantErr: "name must be at most 255 characters",
+		},
+		{
+			name:    "every field invalid",
+			req:     SignupRequest{Email: "nope"},
+			wantErr: "name cannot be empty; invalid email address; password cannot be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := request.Validate(tt.req)
+			if tt.wantErr == "" {
+				if len(fields) > 0 {
+					t.Errorf("Validate() = %v, want no errors", fields)
+				}
+				return
+			}
+			if got := apperr.Validation(fields...).Error(); got != tt.wantErr {
+				t.Errorf("Validate() = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/signup"
+)
+
+type Handler struct {
+	DB     *db.PostgresDB
+	Signup *signup.Policy
+}
+
+func New(database *db.PostgresDB, signupPolicy *signup.Policy) *Handler {
+	return &Handler{DB: database, Signup: signupPolicy}
+}
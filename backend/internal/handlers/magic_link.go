@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/mailer"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/go-pkgz/auth/v2/provider"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const magicLinkEmailTmpl = `Hi,
+
+Use the link below to sign in. It expires in %d minutes and can only be used once.
+
+%s
+
+If you did not request this email you can safely ignore it.
+`
+
+// magicLinkCSRFCookie holds the double-submit token of the confirmation page, so a third
+// party page can't post its own link token and sign the visitor into another account
+const magicLinkCSRFCookie = "magic_link_csrf"
+
+// MagicLinkRequest is the body of a login link request
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+// MagicLinkConfirmForm is the form the confirmation page posts to /auth/email/callback
+type MagicLinkConfirmForm struct {
+	Token string `json:"token" validate:"required"`
+	Aud   string `json:"aud,omitempty"`
+	Sess  string `json:"sess,omitempty"` // 1 for a session cookie that expires with the browser
+	CSRF  string `json:"csrf" validate:"required"`
+}
+
+// magicLinkConfirmTmpl is the page the emailed link opens. Mail scanners and link previews
+// follow links, so opening it only shows a button, the token is spent by the POST it sends.
+var magicLinkConfirmTmpl = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>Sign in</title>
+<style nonce="{{.Nonce}}">
+body { font-family: system-ui, sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+button { display: block; width: 100%; margin: .5rem 0; padding: .5rem; }
+</style>
+</head>
+<body>
+<h1>Sign in</h1>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="aud" value="{{.Aud}}">
+<input type="hidden" name="sess" value="{{.Sess}}">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>`))
+
+// MagicLinkProvider implements passwordless login for go-pkgz/auth.
+// Users request a link by email, the link carries a random single-use token
+// which is exchanged for the regular JWT session.
+//
+//	POST /auth/email/login {"email": "..."}      sends the link
+//	GET  /auth/email/login?token=...&aud=...     shows the confirmation page
+//	POST /auth/email/callback token=...&aud=...  logs the user in, with the page's csrf cookie
+type MagicLinkProvider struct {
+	name         string
+	h            *Handler
+	conf         cfg.MagicLinkConfig
+	baseURL      string
+	issuer       string
+	tokenService provider.TokenService
+	mailer       mailer.Mailer
+}
+
+// MagicLinkProvider returns the passwordless provider, to be registered with AddCustomHandler
+func (h *Handler) MagicLinkProvider(name string, conf cfg.MagicLinkConfig, baseURL, issuer string,
+	ts provider.TokenService, m mailer.Mailer) *MagicLinkProvider {
+	return &MagicLinkProvider{
+		name:         name,
+		h:            h,
+		conf:         conf,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		issuer:       issuer,
+		tokenService: ts,
+		mailer:       m,
+	}
+}
+
+// Name of the provider
+func (p *MagicLinkProvider) Name() string { return p.name }
+
+// LoginHandler sends a login link, or shows the confirmation page when a token is presented
+func (p *MagicLinkProvider) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if tkn := r.URL.Query().Get("token"); tkn != "" && r.Method == http.MethodGet {
+		p.confirmLogin(w, r, tkn)
+		return
+	}
+	p.sendLink(w, r)
+}
+
+// AuthHandler completes the login with the token posted by the confirmation page
+func (p *MagicLinkProvider) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, provider.MaxHTTPBodySize)
+	tkn := r.PostFormValue("token")
+	if tkn == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	if !p.checkCSRF(r) {
+		http.Error(w, "login link must be confirmed on its own page, open it again", http.StatusForbidden)
+		return
+	}
+	p.completeLogin(w, r, tkn)
+}
+
+// LogoutHandler - GET /logout
+func (p *MagicLinkProvider) LogoutHandler(w http.ResponseWriter, _ *http.Request) {
+	p.tokenService.Reset(w)
+}
+
+func (p *MagicLinkProvider) sendLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MagicLinkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, provider.MaxHTTPBodySize)).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if errs := request.Validate(req); len(errs) > 0 {
+		http.Error(w, errs[0].Message, http.StatusBadRequest)
+		return
+	}
+
+	email, err := authutil.NormalizeEmail(req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to probe for accounts
+	sent := map[string]string{"status": "sent"}
+
+	// don't mail links to addresses that couldn't sign up anyway
+	allowed, err := p.mayLogin(ctx, email)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check signup policy")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		log.Info().Str("email", email).Msg("login link requested for unknown email not allowed to sign up")
+		request.WriteJSON(w, http.StatusOK, sent)
+		return
+	}
+
+	tkn, err := authutil.RandomToken()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate login token")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(p.conf.TokenTTL) * time.Minute)
+	if err := p.h.DB.CreateLoginToken(ctx, email, authutil.HashToken(tkn), expiresAt); err != nil {
+		log.Error().Err(err).Msg("failed to store login token")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	link := fmt.Sprintf("%s/auth/%s/login?token=%s", p.baseURL, p.name, url.QueryEscape(tkn))
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body:    fmt.Sprintf(magicLinkEmailTmpl, p.conf.TokenTTL, link),
+	}
+	if err := p.mailer.Send(ctx, msg); err != nil {
+		log.Error().Err(err).Str("email", email).Msg("failed to send login link")
+		http.Error(w, "failed to send email", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("email", email).Msg("login link sent")
+	request.WriteJSON(w, http.StatusOK, sent)
+}
+
+// confirmLogin renders the page that posts tkn back, it leaves the token unused
+func (p *MagicLinkProvider) confirmLogin(w http.ResponseWriter, r *http.Request, tkn string) {
+	csrf, err := authutil.RandomToken()
+	if err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("failed to generate csrf token")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCSRFCookie,
+		Value:    csrf,
+		Path:     "/auth/" + p.name + "/callback",
+		MaxAge:   p.conf.TokenTTL * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	_ = magicLinkConfirmTmpl.Execute(w, map[string]string{
+		"Nonce":  middleware.CSPNonce(r.Context()),
+		"Action": "/auth/" + p.name + "/callback",
+		"Token":  tkn,
+		"Aud":    r.URL.Query().Get("aud"),
+		"Sess":   r.URL.Query().Get("sess"),
+		"CSRF":   csrf,
+	})
+}
+
+// checkCSRF compares the posted token with the cookie set by the confirmation page
+func (p *MagicLinkProvider) checkCSRF(r *http.Request) bool {
+	c, err := r.Cookie(magicLinkCSRFCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("csrf"))) == 1
+}
+
+func (p *MagicLinkProvider) completeLogin(w http.ResponseWriter, r *http.Request, tkn string) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	email, err := p.h.DB.ConsumeLoginToken(ctx, authutil.HashToken(tkn))
+	if err != nil {
+		if errors.Is(err, db.ErrLoginTokenInvalid) {
+			http.Error(w, "login link is invalid or expired", http.StatusForbidden)
+			return
+		}
+		log.Error().Err(err).Msg("failed to consume login token")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	dbUser, err := p.findOrCreateUser(ctx, email)
+	if err != nil {
+		if denied := signupDenied(err); denied != nil {
+			log.Info().Str("email", email).Err(err).Msg("first login rejected by signup policy")
+			http.Error(w, denied.Message, http.StatusForbidden)
+			return
+		}
+		log.Error().Err(err).Str("email", email).Msg("failed to load user for login link")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// following the link proves ownership of the address
+	if !dbUser.EmailVerified {
+		if err := p.h.DB.MarkEmailVerified(ctx, dbUser.Id); err != nil {
+			log.Error().Err(err).Str("user_id", dbUser.Id.String()).Msg("failed to mark email verified")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	cid, err := authutil.RandomToken()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate token id")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// ClaimsUpdater enriches these claims with uid and provider when the token is made
+	claims := token.Claims{
+		User: &token.User{
+			Name:  dbUser.Name,
+			Email: dbUser.Email,
+			ID:    p.name + "_" + token.HashID(sha1.New(), dbUser.Id.String()),
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       cid,
+			Issuer:   p.issuer,
+			Audience: []string{r.PostFormValue("aud")},
+		},
+		SessionOnly: r.PostFormValue("sess") == "1",
+		AuthProvider: &token.AuthProvider{
+			Name: p.name,
+		},
+	}
+
+	if _, err := p.tokenService.Set(w, claims); err != nil {
+		log.Error().Err(err).Msg("failed to set token")
+		http.Error(w, "failed to set token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("user_id", dbUser.Id.String()).Msg("user logged in with login link")
+
+	if p.conf.RedirectURL != "" {
+		http.Redirect(w, r, p.conf.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	request.WriteJSON(w, http.StatusOK, claims.User)
+}
+
+// mayLogin reports whether email has an account or would be allowed to create one
+func (p *MagicLinkProvider) mayLogin(ctx context.Context, email string) (bool, error) {
+	exists, err := p.h.DB.EmailExists(ctx, email)
+	if err != nil || exists {
+		return exists, err
+	}
+	if p.h.Signup.CheckEmail(email) != nil {
+		return false, nil
+	}
+	if p.h.Signup.InviteRequired() {
+		return p.h.DB.HasSignupInvite(ctx, email)
+	}
+	return true, nil
+}
+
+// findOrCreateUser returns the user for email, creating it when the signup policy allows
+func (p *MagicLinkProvider) findOrCreateUser(ctx context.Context, email string) (*models.User, error) {
+	dbUser, err := p.h.DB.GetUserByEmail(ctx, email)
+	if err == nil {
+		return dbUser, nil
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// following the link verified the address, so an invite for it is enough
+	if err := p.h.CheckSignup(ctx, email, "", true); err != nil {
+		return nil, err
+	}
+
+	logger.Ctx(ctx).Info().Str("email", email).Msg("creating user on first login link use")
+	return p.h.CreateSignupUser(ctx, models.User{
+		Name:          strings.SplitN(email, "@", 2)[0],
+		Email:         email,
+		EmailVerified: true,
+		AuthProvider:  models.AuthProviderEmail,
+	}, "")
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+func TestMagicLinkConfirmPage(t *testing.T) {
+	// without a database, the page must not look the token up
+	p := (&Handler{}).MagicLinkProvider("email", cfg.MagicLinkConfig{}, "http://localhost:8080", "test", nil, nil)
+
+	rec := httptest.NewRecorder()
+	p.LoginHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/email/login?token=abc%22def&aud=app&sess=1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want html", ct)
+	}
+	// the form carries the token of the csrf cookie the page sets
+	var csrf *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == magicLinkCSRFCookie {
+			csrf = c
+		}
+	}
+	if csrf == nil || csrf.Value == "" {
+		t.Fatal("page did not set the csrf cookie")
+	}
+	if csrf.Path != "/auth/email/callback" || !csrf.HttpOnly || csrf.SameSite != http.SameSiteStrictMode {
+		t.Errorf("csrf cookie = %+v, want an http only strict cookie for the callback", csrf)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`name="csrf" value="` + csrf.Value + `"`,
+		`<form method="post" action="/auth/email/callback">`,
+		`name="token" value="abc&#34;def"`,
+		`name="aud" value="app"`,
+		`name="sess" value="1"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestMagicLinkCallback(t *testing.T) {
+	p := (&Handler{}).MagicLinkProvider("email", cfg.MagicLinkConfig{}, "http://localhost:8080", "test", nil, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		cookie string
+		want   int
+	}{
+		{name: "get", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "missing token", method: http.MethodPost, body: "aud=app", want: http.StatusBadRequest},
+		// a cross site form can post a token but can't set the cookie of this site
+		{name: "missing csrf cookie", method: http.MethodPost, body: "token=abc&csrf=xyz", want: http.StatusForbidden},
+		{name: "csrf mismatch", method: http.MethodPost, body: "token=abc&csrf=xyz", cookie: "other", want: http.StatusForbidden},
+		{name: "missing csrf field", method: http.MethodPost, body: "token=abc", cookie: "xyz", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/auth/email/callback", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: magicLinkCSRFCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			p.AuthHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package health
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiskSpace fails when the file system holding path has less than minFree bytes available
+// to the process. Platforms without statfs always pass.
+func DiskSpace(path string, minFree uint64) CheckFunc {
+	return func(context.Context) error {
+		free, ok, err := freeBytes(path)
+		if err != nil {
+			return fmt.Errorf("stat file system of %s: %w", path, err)
+		}
+		if ok && free < minFree {
+			return fmt.Errorf("%d MiB free on the file system of %s, want at least %d MiB", free>>20, path, minFree>>20)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd)
+
+package health
+
+func freeBytes(string) (uint64, bool, error) {
+	return 0, false, nil
+}
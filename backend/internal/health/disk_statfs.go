@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package health
+
+import "syscall"
+
+// freeBytes returns the bytes available to unprivileged users on the file system of path
+func freeBytes(path string) (uint64, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true, nil
+}
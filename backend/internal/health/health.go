@@ -0,0 +1,294 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+)
+
+// DefaultTimeout bounds checks registered without a timeout
+const DefaultTimeout = 2 * time.Second
+
+// Status of a check or of the whole report
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded" // only non-critical checks fail, still ready
+	StatusDown     Status = "down"
+)
+
+// CheckFunc returns an error when the component is unhealthy, it must honour ctx
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named component check
+type Check struct {
+	Name    string
+	Run     CheckFunc
+	Timeout time.Duration // defaults to DefaultTimeout
+	// a failing critical check takes the instance out of rotation, others only degrade it
+	Critical bool
+	// also run for liveness, only for failures a restart fixes. Liveness must not depend on
+	// shared dependencies like the database, or an outage restarts every replica at once.
+	Liveness bool
+	// optional, describes the state behind the result, e.g. how startup went. Unlike errors it
+	// is shown on public endpoints too, keep hosts and credentials out of it.
+	Detail func() string
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// Report is the response body of the health endpoints
+type Report struct {
+	Status   Status            `json:"status"`
+	Draining bool              `json:"draining,omitempty"` // shutting down, readiness fails without running checks
+	Checks   map[string]Result `json:"checks"`
+}
+
+// Registry runs the registered checks for the liveness and readiness endpoints. Results are
+// cached for the TTL and concurrent probes share one run, so probes from every load balancer
+// and orchestrator don't turn into a query each.
+type Registry struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	checks []Check
+
+	runMu  sync.Mutex // one run at a time, waiting probes get its result
+	cached map[bool]cachedReport
+
+	draining atomic.Bool
+}
+
+type cachedReport struct {
+	report Report
+	at     time.Time
+}
+
+// New creates an empty registry caching results for ttl, 0 runs the checks on every probe
+func New(ttl time.Duration) *Registry {
+	return &Registry{ttl: ttl, cached: map[bool]cachedReport{}}
+}
+
+// Register adds a check, a name registered twice replaces the earlier check
+func (reg *Registry) Register(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for i := range reg.checks {
+		if reg.checks[i].Name == c.Name {
+			reg.checks[i] = c
+			return
+		}
+	}
+	reg.checks = append(reg.checks, c)
+}
+
+// Drain fails readiness from now on so load balancers stop sending new requests, liveness
+// keeps passing so the orchestrator doesn't kill the process while it finishes
+func (reg *Registry) Drain() {
+	reg.draining.Store(true)
+}
+
+// Live reports whether the process works, only checks marked Liveness run
+func (reg *Registry) Live(ctx context.Context) Report {
+	return reg.report(ctx, true)
+}
+
+// Ready reports whether the instance can serve traffic, every check runs
+func (reg *Registry) Ready(ctx context.Context) Report {
+	if reg.draining.Load() {
+		return Report{Status: StatusDown, Draining: true, Checks: map[string]Result{}}
+	}
+	return reg.report(ctx, false)
+}
+
+func (reg *Registry) report(ctx context.Context, live bool) Report {
+	reg.runMu.Lock()
+	defer reg.runMu.Unlock()
+	if c, ok := reg.cached[live]; ok && time.Since(c.at) < reg.ttl {
+		return c.report
+	}
+
+	reg.mu.Lock()
+	var checks []Check
+	for _, c := range reg.checks {
+		if !live || c.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	reg.mu.Unlock()
+
+	// a probe that hangs up must not cache failures for everyone else
+	ctx = context.WithoutCancel(ctx)
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	for i, c := range checks {
+		res := results[i]
+		report.Checks[c.Name] = res
+		if res.Status == StatusUp {
+			continue
+		}
+		if c.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	reg.logChanges(live, report)
+	reg.cached[live] = cachedReport{report: report, at: time.Now()}
+	return report
+}
+
+// logChanges logs checks that started or stopped failing since the previous run
+func (reg *Registry) logChanges(live bool, report Report) {
+	previous := reg.cached[live].report.Checks
+	names := make([]string, 0, len(report.Checks))
+	for name := range report.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := report.Checks[name]
+		before, seen := previous[name]
+		switch {
+		case res.Status != StatusUp && (!seen || before.Status == StatusUp):
+			logger.L().Warn().Str("check", name).Bool("critical", res.Critical).Str("error", res.Error).Msg("Health check failing")
+		case res.Status == StatusUp && seen && before.Status != StatusUp:
+			logger.L().Info().Str("check", name).Msg("Health check recovered")
+		}
+	}
+}
+
+func run(ctx context.Context, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	res := Result{Status: StatusUp, Critical: c.Critical, CheckedAt: start.UTC()}
+
+	// a check that ignores ctx still can't hold up the probe past its timeout
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- c.Run(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res.Duration = float64(time.Since(start).Microseconds()) / 1000
+	if c.Detail != nil {
+		res.Detail = c.Detail()
+	}
+	if err != nil {
+		res.Status, res.Error = StatusDown, err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			res.Error = "timed out after " + c.Timeout.String()
+		}
+	}
+	return res
+}
+
+// LiveHandler serves the liveness report, 503 when a liveness check fails
+func (reg *Registry) LiveHandler(showErrors bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, reg.Live(r.Context()), showErrors)
+	}
+}
+
+// ReadyHandler serves the readiness report, 503 when a critical check fails. Error messages
+// can name hosts and users, only show them where the endpoint isn't public.
+func (reg *Registry) ReadyHandler(showErrors bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, reg.Ready(r.Context()), showErrors)
+	}
+}
+
+// TextHandler answers readiness with a plain OK for probes that only look at the status code
+func (reg *Registry) TextHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if report := reg.Ready(r.Context()); report.Status == StatusDown {
+			var err error
+			if report.Draining {
+				err = errors.New("shutting down")
+			} else {
+				err = fmt.Errorf("failing critical checks: %s", strings.Join(report.Failing(true), ", "))
+			}
+			apperr.Write(w, r, apperr.Unavailable("not ready", err))
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	}
+}
+
+// Failing returns the names of the failing checks, only critical ones if criticalOnly is set
+func (r Report) Failing(criticalOnly bool) []string {
+	var names []string
+	for name, res := range r.Checks {
+		if res.Status != StatusUp && (res.Critical || !criticalOnly) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeReport(w http.ResponseWriter, report Report, showErrors bool) {
+	if !showErrors {
+		checks := make(map[string]Result, len(report.Checks))
+		for name, res := range report.Checks {
+			res.Error = ""
+			checks[name] = res
+		}
+		report.Checks = checks
+	}
+
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,175 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func pass(context.Context) error { return nil }
+func fail(context.Context) error { return errors.New("connection refused") }
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Status
+	}{
+		{name: "no checks", want: StatusUp},
+		{name: "all pass", checks: []Check{{Name: "db", Run: pass, Critical: true}, {Name: "mailer", Run: pass}}, want: StatusUp},
+		{name: "non-critical fails", checks: []Check{{Name: "db", Run: pass, Critical: true}, {Name: "mailer", Run: fail}}, want: StatusDegraded},
+		{name: "critical fails", checks: []Check{{Name: "db", Run: fail, Critical: true}, {Name: "mailer", Run: fail}}, want: StatusDown},
+		{name: "timeout", checks: []Check{{Name: "db", Critical: true, Timeout: 10 * time.Millisecond,
+			Run: func(context.Context) error { time.Sleep(time.Second); return nil }}}, want: StatusDown},
+		{name: "panic", checks: []Check{{Name: "db", Critical: true, Run: func(context.Context) error { panic("boom") }}}, want: StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := New(0)
+			for _, c := range tt.checks {
+				reg.Register(c)
+			}
+			report := reg.Ready(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("status = %s, want %s: %+v", report.Status, tt.want, report.Checks)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("got %d results, want %d", len(report.Checks), len(tt.checks))
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	reg := New(0)
+	reg.Register(Check{Name: "db", Run: fail, Critical: true})
+	reg.Register(Check{Name: "deadlock", Run: pass, Critical: true, Liveness: true})
+
+	report := reg.Live(context.Background())
+	if report.Status != StatusUp {
+		t.Errorf("status = %s, want up, the database must not fail liveness", report.Status)
+	}
+	if _, ok := report.Checks["db"]; ok {
+		t.Error("liveness ran a readiness-only check")
+	}
+}
+
+func TestCache(t *testing.T) {
+	var runs atomic.Int32
+	count := func(context.Context) error { runs.Add(1); return nil }
+
+	reg := New(time.Hour)
+	reg.Register(Check{Name: "db", Run: count})
+	for range 3 {
+		reg.Ready(context.Background())
+	}
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check ran %d times within the TTL, want 1", n)
+	}
+
+	// a canceled probe still caches a real result
+	reg = New(time.Hour)
+	reg.Register(Check{Name: "db", Run: func(ctx context.Context) error { return ctx.Err() }})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := reg.Ready(ctx); report.Status != StatusUp {
+		t.Errorf("canceled probe status = %s, want up", report.Status)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	reg := New(0)
+	reg.Register(Check{Name: "db", Run: fail, Critical: true})
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		want      int
+		wantError bool
+	}{
+		{name: "ready", handler: reg.ReadyHandler(false), want: http.StatusServiceUnavailable},
+		{name: "ready with errors", handler: reg.ReadyHandler(true), want: http.StatusServiceUnavailable, wantError: true},
+		{name: "live", handler: reg.LiveHandler(false), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			var report Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if got := report.Checks["db"].Error != ""; got != tt.wantError {
+				t.Errorf("error shown = %v, want %v", got, tt.wantError)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	reg.TextHandler()(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("text status = %d, want 503", rec.Code)
+	}
+}
+
+func TestDetail(t *testing.T) {
+	reg := New(0)
+	reg.Register(Check{Name: "migrations", Run: pass, Critical: true, Detail: func() string { return "up to date" }})
+	reg.Register(Check{Name: "db", Run: pass, Critical: true})
+
+	rec := httptest.NewRecorder()
+	reg.ReadyHandler(false)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Checks["migrations"].Detail; got != "up to date" {
+		t.Errorf("detail = %q, want the Detail func result", got)
+	}
+	if got := report.Checks["db"].Detail; got != "" {
+		t.Errorf("detail = %q for a check without Detail", got)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpace(dir, 0)(context.Background()); err != nil {
+		t.Errorf("no minimum: %v", err)
+	}
+	if _, ok, _ := freeBytes(dir); ok {
+		if err := DiskSpace(dir, 1<<62)(context.Background()); err == nil {
+			t.Error("4 EiB free space requirement passed")
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	reg := New(time.Hour)
+	reg.Register(Check{Name: "db", Run: pass, Critical: true})
+	if report := reg.Ready(context.Background()); report.Status != StatusUp {
+		t.Fatalf("status before drain = %s, want up", report.Status)
+	}
+
+	reg.Drain()
+	// the cached result must not hide the drain
+	if report := reg.Ready(context.Background()); report.Status != StatusDown || !report.Draining {
+		t.Errorf("ready while draining = %+v, want down and draining", report)
+	}
+	if report := reg.Live(context.Background()); report.Status != StatusUp {
+		t.Errorf("live while draining = %s, want up", report.Status)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.TextHandler()(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("text status while draining = %d, want 503", rec.Code)
+	}
+}
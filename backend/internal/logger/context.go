@@ -24,3 +24,16 @@ func WithLogger(ctx context.Context, l *zerolog.Logger) context.Context {
 func FromRequest(r *http.Request) *zerolog.Logger {
 	return hlog.FromRequest(r)
 }
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the request ID to ctx so it can be echoed in responses.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID set by the Http middleware, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
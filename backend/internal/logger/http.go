@@ -1,19 +1,19 @@
 package logger
 
 import (
-	"net"
+	"context"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/anish-chanda/go-app-starter/internal/clientip"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 )
 
 func Http(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip noisy endpoints like health
-		// TODO: skip web file server logs as well
+		// Skip noisy endpoints like health, static files lower their level with SetAccessLevel
 		if r.URL.Path == "/api/health" {
 			next.ServeHTTP(w, r)
 			return
@@ -33,7 +33,7 @@ func Http(next http.Handler) http.Handler {
 			path += "?" + r.URL.RawQuery
 		}
 
-		ip := clientIP(r)
+		ip := clientip.FromRequest(r)
 
 		reqLog := L().With().
 			Str("req_id", reqID).
@@ -41,7 +41,9 @@ func Http(next http.Handler) http.Handler {
 			Logger()
 
 		// put logger into context so handlers can use logger.Ctx(r.Context())
-		ctx := reqLog.WithContext(r.Context())
+		ctx := WithRequestID(reqLog.WithContext(r.Context()), reqID)
+		access := &accessLevel{}
+		ctx = context.WithValue(ctx, accessLevelKey{}, access)
 		r = r.WithContext(ctx)
 
 		// call handler chain
@@ -51,7 +53,12 @@ func Http(next http.Handler) http.Handler {
 		dur := time.Since(start)
 		ms := float64(dur.Nanoseconds()) / 1e6
 
-		evt := reqLog.WithLevel(levelForStatus(sw.status)).
+		level := levelForStatus(sw.status)
+		// server errors are always logged at their own level
+		if access.set && sw.status < http.StatusInternalServerError {
+			level = access.level
+		}
+		evt := reqLog.WithLevel(level).
 			Int("bytes", sw.bytes).
 			Float64("duration_ms", ms)
 
@@ -59,17 +66,19 @@ func Http(next http.Handler) http.Handler {
 	})
 }
 
-func clientIP(r *http.Request) string {
-	// If you run behind a reverse proxy you trust, you can prefer X-Forwarded-For
-	// (otherwise, keep RemoteAddr to avoid spoofing).
-	// xff := r.Header.Get("X-Forwarded-For")
-	// if xff != "" { ... }
+type accessLevelKey struct{}
+
+type accessLevel struct {
+	set   bool
+	level zerolog.Level
+}
 
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err == nil && host != "" {
-		return host
+// SetAccessLevel changes the level of the access log line of the current request,
+// zerolog.Disabled drops it. Server errors keep the error level.
+func SetAccessLevel(ctx context.Context, level zerolog.Level) {
+	if a, ok := ctx.Value(accessLevelKey{}).(*accessLevel); ok {
+		a.set, a.level = true, level
 	}
-	return r.RemoteAddr
 }
 
 func levelForStatus(status int) zerolog.Level {
@@ -83,6 +92,8 @@ func levelForStatus(status int) zerolog.Level {
 	}
 }
 
+// statusWriter records the status and the bytes sent to the client, after any compression
+// by middlewares inside logger.Http
 type statusWriter struct {
 	http.ResponseWriter
 	status int
@@ -99,3 +110,13 @@ func (w *statusWriter) Write(p []byte) (int, error) {
 	w.bytes += n
 	return n, err
 }
+
+// Flush passes flushes of streaming handlers on to the connection
+func (w *statusWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,112 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/rs/zerolog"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer, or a log mailer when no SMTP host is configured
+func New(conf cfg.MailConfig, logger *zerolog.Logger) Mailer {
+	l := logger.With().Str("service", "mailer").Logger()
+	if conf.SMTPHost == "" {
+		l.Warn().Msg("SMTP_HOST not set, emails will be written to the log")
+		return &LogMailer{Logger: &l}
+	}
+	return &SMTPMailer{conf: conf, logger: &l}
+}
+
+// LogMailer writes emails to the log, useful for local development
+type LogMailer struct {
+	Logger *zerolog.Logger
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	m.Logger.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg(msg.Body)
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP server using STARTTLS when available
+type SMTPMailer struct {
+	conf   cfg.MailConfig
+	logger *zerolog.Logger
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.conf.SMTPHost, strconv.Itoa(m.conf.SMTPPort))
+
+	var auth smtp.Auth
+	if m.conf.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.conf.SMTPUsername, m.conf.SMTPPassword, m.conf.SMTPHost)
+	}
+
+	// smtp.SendMail has no context support, so run it in the background and honour ctx
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(addr, auth, m.conf.From, []string{msg.To}, buildMessage(m.conf.From, msg))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("send email: %w", err)
+		}
+		m.logger.Debug().Str("to", msg.To).Str("subject", msg.Subject).Msg("email sent")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping connects to the SMTP server and waits for its greeting, used as a health check
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	addr := net.JoinHostPort(m.conf.SMTPHost, strconv.Itoa(m.conf.SMTPPort))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.conf.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("SMTP greeting: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage renders RFC 5322 headers and body
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	h := m.Middleware(mux)
+
+	for _, path := range []string{"/items/1", "/items/2", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		route string
+		code  string
+		want  float64
+	}{
+		{route: "GET /items/{id}", code: "202", want: 2},
+		{route: "unmatched", code: "404", want: 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, tt.route, tt.code)); got != tt.want {
+			t.Errorf("requests{route=%q,code=%s} = %v, want %v", tt.route, tt.code, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(m.inFlight); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, name := range []string{"http_request_duration_seconds_bucket", "go_goroutines", "go_build_info"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("exposition is missing %s", name)
+		}
+	}
+}
+
+func TestNilMiddleware(t *testing.T) {
+	var m *Metrics
+	called := false
+	m.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Error("nil Metrics did not pass the request on")
+	}
+}
@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressOptions configure Compress
+type CompressOptions struct {
+	// Responses smaller than this are sent as is, compressing them costs more than it saves
+	MinSize int
+	// Media types worth compressing. Entries match exactly, a trailing "/" matches a whole
+	// type like text/ and a leading "+" a structured syntax suffix like +json.
+	ContentTypes []string
+}
+
+// DefaultCompressOptions compresses text formats of 1 KiB and more. Event streams are left
+// out since proxies tend to hold back compressed chunks.
+func DefaultCompressOptions() CompressOptions {
+	return CompressOptions{
+		MinSize: 1024,
+		ContentTypes: []string{
+			"text/html", "text/css", "text/plain", "text/javascript", "text/csv", "text/xml",
+			"application/json", "application/javascript", "application/xml", "application/wasm",
+			"image/svg+xml", "+json", "+xml",
+		},
+	}
+}
+
+// encoder is implemented by both gzip.Writer and zstd.Encoder
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encodings in order of preference when the client accepts several with the same q
+var encodings = []string{"zstd", "gzip"}
+
+// Compress encodes responses with zstd or gzip, whichever the client prefers. The body is
+// buffered until MinSize bytes or a Flush, so the decision can look at the final headers.
+// Responses that already have a Content-Encoding, like precompressed static files, pass through.
+// Install it inside logger.Http so the access log counts the bytes that went to the client.
+func Compress(opts CompressOptions) Middleware {
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			enc, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression) // only fails for invalid levels
+			return enc
+		}},
+		"zstd": {New: func() any {
+			// a single goroutine per encoder, concurrency comes from the requests
+			enc, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1)) // only fails for invalid options
+			return enc
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, pools: pools}
+			// HEAD has no body to compress, its headers describe the identity encoding
+			if r.Method != http.MethodHead {
+				cw.encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			}
+			next.ServeHTTP(cw, r)
+			// not deferred, after a panic the buffered body is dropped so Recover can still send a 500
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest q value, "" when none is acceptable
+func negotiateEncoding(header string) string {
+	q := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "*":
+			wildcard = weight
+		case "":
+		default:
+			q[name] = weight
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		weight, ok := q[enc]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the status and the first MinSize bytes until it knows
+// whether the response gets compressed
+type compressWriter struct {
+	http.ResponseWriter
+	opts     *CompressOptions
+	pools    map[string]*sync.Pool
+	encoding string // negotiated encoding, "" when the client accepts none
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder // nil when the body goes out as is
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	// informational responses like 103 Early Hints go out right away
+	if w.decided || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	var err error
+	if !w.eligible() {
+		err = w.start(false)
+	} else if n, lenErr := strconv.Atoi(w.Header().Get("Content-Length")); lenErr == nil {
+		// a known length decides right away instead of buffering
+		err = w.start(n >= w.opts.MinSize)
+	} else if len(w.buf) >= w.opts.MinSize {
+		err = w.start(true)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far. A flushed response is a stream of unknown
+// length, so it is compressed if eligible no matter how small it is yet.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.start(w.eligible()); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// eligible reports whether the response could be compressed and adds Vary when the
+// representation depends on Accept-Encoding. The size is checked by the caller.
+func (w *compressWriter) eligible() bool {
+	h := w.Header()
+	switch w.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" ||
+		strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	ctype := h.Get("Content-Type")
+	if ctype == "" && len(w.buf) > 0 {
+		// net/http would sniff the compressed bytes, so sniff the plain ones here
+		ctype = http.DetectContentType(w.buf)
+		h.Set("Content-Type", ctype)
+	}
+	if !w.compressible(ctype) {
+		return false
+	}
+
+	if !slices.ContainsFunc(h.Values("Vary"), func(v string) bool {
+		return strings.Contains(strings.ToLower(v), "accept-encoding")
+	}) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	return w.encoding != ""
+}
+
+func (w *compressWriter) compressible(ctype string) bool {
+	media, _, _ := strings.Cut(ctype, ";")
+	media = strings.ToLower(strings.TrimSpace(media))
+	if media == "" {
+		return false
+	}
+	for _, t := range w.opts.ContentTypes {
+		switch {
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(media, t),
+			strings.HasPrefix(t, "+") && strings.HasSuffix(media, t),
+			media == t:
+			return true
+		}
+	}
+	return false
+}
+
+// start sends the headers and the buffered body, compressed or not
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		// the length and byte ranges of the plain body don't apply to the encoded one
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		// a strong ETag promises identical bytes, the encoded body is only equivalent
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = w.pools[w.encoding].Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close sends a response that stayed below MinSize and finishes the encoded stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// nothing was written, net/http sends its implicit 200
+			return
+		}
+		_ = w.start(false)
+		return
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(io.Discard) // don't keep the connection's writer alive in the pool
+		w.pools[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
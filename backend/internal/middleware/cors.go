@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy decides which cross-origin requests the browser may make
+type CORSPolicy struct {
+	// Exact origins like https://app.example.com, subdomain wildcards like https://*.example.com,
+	// or "*" for any origin. An empty list disables CORS for the policy.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// Response headers the client may read
+	ExposedHeaders []string
+	// Send cookies. Browsers refuse credentials for "*", so they only apply to listed origins.
+	AllowCredentials bool
+	// How long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// DefaultCORSPolicy allows the methods and headers the API and the go-pkgz auth endpoints use
+func DefaultCORSPolicy(origins []string, credentials bool, maxAge time.Duration) CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		// X-XSRF-TOKEN and X-JWT are the go-pkgz xsrf and token headers
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-XSRF-TOKEN", "X-JWT", "X-Request-Id"},
+		ExposedHeaders: []string{"X-JWT", "X-Request-Id",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+		AllowCredentials: credentials,
+		MaxAge:           maxAge,
+	}
+}
+
+// CORS answers preflight requests and adds CORS headers to responses. It has to run
+// before routing since the mux doesn't know OPTIONS for routes registered with a method.
+// overrides maps path prefixes to their own policy, the longest matching prefix wins.
+func CORS(policy CORSPolicy, overrides map[string]CORSPolicy) Middleware {
+	def := compileCORS(policy)
+	prefixes := make([]string, 0, len(overrides))
+	compiled := make(map[string]*corsPolicy, len(overrides))
+	for prefix, p := range overrides {
+		prefixes = append(prefixes, prefix)
+		compiled[prefix] = compileCORS(p)
+	}
+	// longest first so the most specific override is found first
+	slices.SortFunc(prefixes, func(a, b string) int { return len(b) - len(a) })
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := def
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					p = compiled[prefix]
+					break
+				}
+			}
+			p.serve(w, r, next)
+		})
+	}
+}
+
+type corsPolicy struct {
+	any         bool
+	exact       map[string]struct{}
+	wildcards   [][2]string // scheme://*. prefix and domain suffix
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+func compileCORS(p CORSPolicy) *corsPolicy {
+	c := &corsPolicy{
+		exact:       map[string]struct{}{},
+		methods:     strings.Join(p.AllowedMethods, ", "),
+		headers:     strings.Join(p.AllowedHeaders, ", "),
+		exposed:     strings.Join(p.ExposedHeaders, ", "),
+		credentials: p.AllowCredentials,
+	}
+	if p.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+	for _, o := range p.AllowedOrigins {
+		o = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(o), "/"))
+		switch {
+		case o == "":
+		case o == "*":
+			c.any = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(o, "://*.")
+			c.wildcards = append(c.wildcards, [2]string{scheme + "://", "." + domain})
+		default:
+			c.exact[o] = struct{}{}
+		}
+	}
+	return c
+}
+
+func (c *corsPolicy) enabled() bool {
+	return c.any || len(c.exact) > 0 || len(c.wildcards) > 0
+}
+
+func (c *corsPolicy) allowed(origin string) bool {
+	if c.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := c.exact[origin]; ok {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if host, ok := strings.CutPrefix(origin, w[0]); ok && strings.HasSuffix(host, w[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *corsPolicy) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	if !c.enabled() {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	// the response differs per origin unless every origin gets the same "*"
+	if !c.any {
+		h.Add("Vary", "Origin")
+	}
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if origin == "" || !c.allowed(origin) {
+		if preflight {
+			// no CORS headers tells the browser the request isn't allowed
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if c.any {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+		if c.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if preflight {
+		h.Set("Access-Control-Allow-Methods", c.methods)
+		if c.headers != "" {
+			h.Set("Access-Control-Allow-Headers", c.headers)
+		}
+		if c.maxAge != "" {
+			h.Set("Access-Control-Max-Age", c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if c.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", c.exposed)
+	}
+	next.ServeHTTP(w, r)
+}
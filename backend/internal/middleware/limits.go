@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+)
+
+// CodeTimeout is the problem code of requests that ran out of time
+const CodeTimeout = "timeout"
+
+// Timeout gives the handler d to respond. The request context carries the deadline, so
+// database calls and outgoing requests give up with it. If the handler hasn't started its
+// response by then it is answered with a 503 problem, anything it writes afterwards is
+// dropped. Handlers that ignore the context keep the connection until they return.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+			next.ServeHTTP(tw, r)
+			if !tw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				apperr.Write(w, r, &apperr.Error{
+					Status:  http.StatusServiceUnavailable,
+					Code:    CodeTimeout,
+					Message: "request timed out",
+					Err:     ctx.Err(),
+				})
+			}
+		})
+	}
+}
+
+// timeoutWriter passes the response through until the deadline, a response that hasn't
+// started by then is left to Timeout
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.wroteHeader || w.timedOut {
+		return
+	}
+	if w.ctx.Err() != nil {
+		w.timedOut = true
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MaxBytes limits request bodies to n bytes. Requests announcing a larger body are
+// rejected with a 413 problem, others fail on read once the limit is hit.
+func MaxBytes(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				apperr.Write(w, r, &apperr.Error{
+					Status:  http.StatusRequestEntityTooLarge,
+					Code:    request.CodeBodyTooLarge,
+					Message: fmt.Sprintf("request body must not be larger than %d bytes", n),
+				})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middlewares, the first one is the outermost
+type Chain []Middleware
+
+// New creates a chain from mws
+func New(mws ...Middleware) Chain {
+	return Chain(mws)
+}
+
+// Append returns a new chain with mws added after the existing ones
+func (c Chain) Append(mws ...Middleware) Chain {
+	out := make(Chain, 0, len(c)+len(mws))
+	out = append(out, c...)
+	return append(out, mws...)
+}
+
+// Then wraps h with the chain, so a request passes the middlewares in order
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// ThenFunc is Then for a handler func
+func (c Chain) ThenFunc(fn http.HandlerFunc) http.Handler {
+	return c.Then(fn)
+}
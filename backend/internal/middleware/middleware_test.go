@@ -0,0 +1,484 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	base := New(mark("a"), mark("b"))
+	extended := base.Append(mark("c"))
+	// appending must not modify the base chain
+	_ = base.Append(mark("x"))
+
+	extended.ThenFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("order = %s, want a,b,c,handler", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	log := zerolog.New(&logs).With().Str("req_id", "req-1").Logger()
+
+	h := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req = req.WithContext(log.WithContext(req.Context()))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	out := logs.String()
+	if !strings.Contains(out, `"req_id":"req-1"`) || !strings.Contains(out, `"panic":"boom"`) || !strings.Contains(out, "TestRecover") {
+		t.Errorf("panic log = %s, want req_id, panic value and stack", out)
+	}
+}
+
+func TestRecoverAfterWrite(t *testing.T) {
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recover() = %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			_, _ = w.Write([]byte("too late"))
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != apperr.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, apperr.ContentType)
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"timeout"`) {
+		t.Errorf("body = %s, want the timeout problem", rec.Body)
+	}
+
+	// a handler that fails on the expired context is answered with the timeout too
+	h = Timeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, "database gone", http.StatusInternalServerError)
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "database gone") {
+		t.Errorf("status = %d, body = %s, want only the timeout problem", rec.Code, rec.Body)
+	}
+
+	// responses in time pass through
+	h = Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	h := MaxBytes(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		want          int
+	}{
+		{name: "within limit", body: "12345678", contentLength: 8, want: http.StatusNoContent},
+		{name: "declared too large", body: "123456789", contentLength: 9, want: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large", body: "123456789", contentLength: -1, want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.contentLength > 8 && rec.Header().Get("Content-Type") != apperr.ContentType {
+				t.Errorf("Content-Type = %q, want a problem", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(
+		DefaultCORSPolicy([]string{"https://app.example.com", "https://*.preview.example.com"}, true, 10*time.Minute),
+		map[string]CORSPolicy{
+			"/.well-known/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}},
+		},
+	)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMaxAge      string
+	}{
+		{name: "same origin request", method: http.MethodGet, path: "/api/health", wantStatus: http.StatusOK},
+		{name: "allowed origin", method: http.MethodPost, path: "/auth/local/signup", origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCredentials: "true"},
+		{name: "wildcard subdomain", method: http.MethodGet, path: "/auth/user", origin: "https://pr-12.preview.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://pr-12.preview.example.com", wantCredentials: "true"},
+		{name: "wildcard needs a subdomain", method: http.MethodGet, path: "/auth/user", origin: "https://preview.example.com",
+			wantStatus: http.StatusOK},
+		{name: "lookalike origin", method: http.MethodGet, path: "/auth/user", origin: "https://app.example.com.evil.com",
+			wantStatus: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, path: "/auth/local/signup", origin: "https://app.example.com", preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com", wantCredentials: "true", wantMaxAge: "600"},
+		{name: "rejected preflight", method: http.MethodOptions, path: "/auth/local/signup", origin: "https://evil.com", preflight: true,
+			wantStatus: http.StatusNoContent},
+		{name: "public override", method: http.MethodGet, path: "/.well-known/jwks.json", origin: "https://evil.com",
+			wantStatus: http.StatusOK, wantOrigin: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "content-type,x-xsrf-token")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			got := rec.Header()
+			if got.Get("Access-Control-Allow-Origin") != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got.Get("Access-Control-Allow-Origin"), tt.wantOrigin)
+			}
+			if got.Get("Access-Control-Allow-Credentials") != tt.wantCredentials {
+				t.Errorf("Allow-Credentials = %q, want %q", got.Get("Access-Control-Allow-Credentials"), tt.wantCredentials)
+			}
+			if got.Get("Access-Control-Max-Age") != tt.wantMaxAge {
+				t.Errorf("Max-Age = %q, want %q", got.Get("Access-Control-Max-Age"), tt.wantMaxAge)
+			}
+			if tt.preflight && tt.wantOrigin != "" && !strings.Contains(got.Get("Access-Control-Allow-Headers"), "X-XSRF-TOKEN") {
+				t.Errorf("Allow-Headers = %q, want the xsrf header", got.Get("Access-Control-Allow-Headers"))
+			}
+			if tt.origin != "" && tt.wantOrigin != "*" && !slices.Contains(got.Values("Vary"), "Origin") {
+				t.Errorf("Vary = %v, want Origin", got.Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCSP(t *testing.T) {
+	csp := NewCSP().
+		Set("default-src", "'self'").
+		Set("script-src", "'self'", CSPNonceSource).
+		Add("script-src", "https://cdn.example.com", "'self'").
+		Set("upgrade-insecure-requests")
+
+	want := "default-src 'self'; script-src 'self' 'nonce-abc' https://cdn.example.com; upgrade-insecure-requests"
+	if got := csp.String("abc"); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	clone := csp.Clone().Remove("upgrade-insecure-requests").Set("default-src", "'none'")
+	if got := csp.String("abc"); got != want {
+		t.Errorf("changing a clone changed the original: %q", got)
+	}
+	if got := clone.String(""); got != "default-src 'none'; script-src 'self' https://cdn.example.com" {
+		t.Errorf("clone String() = %q", got)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var nonce string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r.Context())
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		SecurityHeaders(DefaultSecurityHeaders())(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		h := rec.Header()
+		for name, want := range map[string]string{
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+		} {
+			if got := h.Get(name); got != want {
+				t.Errorf("%s = %q, want %q", name, got, want)
+			}
+		}
+		if nonce == "" || !strings.Contains(h.Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+			t.Errorf("CSP = %q, want nonce %q", h.Get("Content-Security-Policy"), nonce)
+		}
+	})
+
+	t.Run("fresh nonce per request", func(t *testing.T) {
+		h := SecurityHeaders(DefaultSecurityHeaders())(next)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		first := nonce
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if first == nonce {
+			t.Error("nonce was reused")
+		}
+	})
+
+	t.Run("dev without hsts, report only", func(t *testing.T) {
+		conf := DefaultSecurityHeaders()
+		conf.HSTSMaxAge = 0
+		conf.CSPReportOnly = true
+		conf.CSP = NewCSP().Set("default-src", "'self'")
+
+		rec := httptest.NewRecorder()
+		SecurityHeaders(conf)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		h := rec.Header()
+		if h.Get("Strict-Transport-Security") != "" {
+			t.Error("HSTS sent although disabled")
+		}
+		if h.Get("Content-Security-Policy") != "" || h.Get("Content-Security-Policy-Report-Only") != "default-src 'self'" {
+			t.Errorf("CSP headers = %v", h)
+		}
+		if nonce != "" {
+			t.Errorf("nonce = %q for a policy without nonces", nonce)
+		}
+	})
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip, deflate, br", want: "gzip"},
+		{header: "gzip, deflate, br, zstd", want: "zstd"},
+		{header: "zstd;q=0.5, gzip", want: "gzip"},
+		{header: "GZIP;q=0.8", want: "gzip"},
+		{header: "*", want: "zstd"},
+		{header: "*;q=0.5, zstd;q=0", want: "gzip"},
+		{header: "gzip;q=0, br", want: ""},
+		{header: "identity", want: ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"value"}`, 128)
+	opts := DefaultCompressOptions()
+	opts.MinSize = 1024
+
+	tests := []struct {
+		name         string
+		method       string
+		accept       string
+		header       http.Header
+		status       int
+		body         string
+		wantEncoding string
+		wantVary     bool
+	}{
+		{name: "gzip", accept: "gzip", header: http.Header{"Content-Type": {"application/json"}},
+			body: large, wantEncoding: "gzip", wantVary: true},
+		{name: "zstd preferred", accept: "gzip, zstd", header: http.Header{"Content-Type": {"application/json"}},
+			body: large, wantEncoding: "zstd", wantVary: true},
+		{name: "problem json", accept: "gzip", header: http.Header{"Content-Type": {"application/problem+json"}},
+			status: http.StatusBadRequest, body: large, wantEncoding: "gzip", wantVary: true},
+		{name: "sniffed type", accept: "gzip", body: strings.Repeat("plain text ", 128), wantEncoding: "gzip", wantVary: true},
+		{name: "below min size", accept: "gzip", header: http.Header{"Content-Type": {"application/json"}},
+			body: `{"ok":true}`, wantVary: true},
+		{name: "known length", accept: "gzip", header: http.Header{"Content-Type": {"application/json"}, "Content-Length": {strconv.Itoa(len(large))}},
+			body: large, wantEncoding: "gzip", wantVary: true},
+		{name: "client accepts none", header: http.Header{"Content-Type": {"application/json"}},
+			body: large, wantVary: true},
+		{name: "type not allowed", accept: "gzip", header: http.Header{"Content-Type": {"image/png"}},
+			body: large},
+		{name: "already encoded", accept: "gzip", header: http.Header{"Content-Type": {"text/javascript"}, "Content-Encoding": {"br"}},
+			body: large, wantEncoding: "br"},
+		{name: "partial content", accept: "gzip", header: http.Header{"Content-Type": {"text/plain"}, "Content-Range": {"bytes 0-2047/4096"}},
+			status: http.StatusPartialContent, body: large},
+		{name: "head", method: http.MethodHead, accept: "gzip", header: http.Header{"Content-Type": {"application/json"}},
+			body: large, wantVary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(opts)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// several writes so buffering across the threshold is covered
+				for chunk := range slices.Chunk([]byte(tt.body), 300) {
+					_, _ = w.Write(chunk)
+				}
+			}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			wantStatus := tt.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if rec.Code != wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, wantStatus)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := slices.Contains(rec.Header().Values("Vary"), "Accept-Encoding"); got != tt.wantVary {
+				t.Errorf("Vary = %v, want Accept-Encoding %v", rec.Header().Values("Vary"), tt.wantVary)
+			}
+			if rec.Header().Get("Content-Type") == "" {
+				t.Error("Content-Type not set")
+			}
+
+			var body []byte
+			switch tt.wantEncoding {
+			case "gzip", "zstd":
+				if rec.Header().Get("Content-Length") != "" {
+					t.Errorf("Content-Length = %q, want none", rec.Header().Get("Content-Length"))
+				}
+				body = decompress(t, tt.wantEncoding, rec.Body.Bytes())
+			default:
+				body = rec.Body.Bytes()
+			}
+			if string(body) != tt.body {
+				t.Errorf("body differs, got %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	flushed := make(chan struct{})
+	h := Compress(DefaultCompressOptions())(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("first"))
+		// statusWriter of the access log sits in between in the real chain
+		w.(http.Flusher).Flush()
+		close(flushed)
+		_, _ = w.Write([]byte(" second"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	<-flushed
+
+	if !rec.Flushed {
+		t.Error("response not flushed")
+	}
+	// a stream is compressed even though it is below the minimum size
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+	}
+	if got := string(decompress(t, "gzip", rec.Body.Bytes())); got != "first second" {
+		t.Errorf("body = %q, want %q", got, "first second")
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("zstd: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompress %s: %v", encoding, err)
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+)
+
+// Recover turns a panicking handler into a 500 and logs the panic with its stack.
+// Install it inside logger.Http so the log line carries the req_id.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &headerWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// the handler asked to abort the connection, let net/http do it
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			logger.Ctx(r.Context()).Error().
+				Str("panic", fmt.Sprint(v)).
+				Bytes("stack", debug.Stack()).
+				Msgf("panic serving %s %s", r.Method, r.URL.Path)
+
+			if rw.wroteHeader {
+				// part of the response is already out, abort so the client sees it's truncated
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(rw, "internal server error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// headerWriter records whether the response has started
+type headerWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
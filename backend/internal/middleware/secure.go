@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSPNonceSource is a placeholder source that is replaced by 'nonce-...' with a fresh nonce per request.
+// Pages read the nonce with CSPNonce and put it on their inline <script> and <style> tags.
+const CSPNonceSource = "'nonce'"
+
+// CSP builds a Content-Security-Policy, directives keep the order they were added in
+type CSP struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// NewCSP returns an empty policy
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// DefaultCSP only allows same origin resources and inline code carrying the request nonce
+func DefaultCSP() *CSP {
+	return NewCSP().
+		Set("default-src", "'self'").
+		Set("script-src", "'self'", CSPNonceSource).
+		Set("style-src", "'self'", CSPNonceSource).
+		Set("img-src", "'self'", "data:").
+		Set("object-src", "'none'").
+		Set("base-uri", "'self'").
+		Set("frame-ancestors", "'none'")
+}
+
+// Set replaces the sources of a directive, a directive without sources like upgrade-insecure-requests is allowed
+func (c *CSP) Set(directive string, sources ...string) *CSP {
+	for i := range c.directives {
+		if c.directives[i].name == directive {
+			c.directives[i].sources = slices.Clone(sources)
+			return c
+		}
+	}
+	c.directives = append(c.directives, cspDirective{name: directive, sources: slices.Clone(sources)})
+	return c
+}
+
+// Add appends sources to a directive, creating it if needed
+func (c *CSP) Add(directive string, sources ...string) *CSP {
+	for i := range c.directives {
+		if c.directives[i].name == directive {
+			for _, s := range sources {
+				if !slices.Contains(c.directives[i].sources, s) {
+					c.directives[i].sources = append(c.directives[i].sources, s)
+				}
+			}
+			return c
+		}
+	}
+	return c.Set(directive, sources...)
+}
+
+// Remove drops a directive
+func (c *CSP) Remove(directive string) *CSP {
+	c.directives = slices.DeleteFunc(c.directives, func(d cspDirective) bool { return d.name == directive })
+	return c
+}
+
+// Clone returns a copy that can be changed without affecting c
+func (c *CSP) Clone() *CSP {
+	out := &CSP{directives: make([]cspDirective, len(c.directives))}
+	for i, d := range c.directives {
+		out.directives[i] = cspDirective{name: d.name, sources: slices.Clone(d.sources)}
+	}
+	return out
+}
+
+// UsesNonce reports whether any directive contains CSPNonceSource
+func (c *CSP) UsesNonce() bool {
+	for _, d := range c.directives {
+		if slices.Contains(d.sources, CSPNonceSource) {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the header value, nonce replaces CSPNonceSource
+func (c *CSP) String(nonce string) string {
+	parts := make([]string, 0, len(c.directives))
+	for _, d := range c.directives {
+		var b strings.Builder
+		b.WriteString(d.name)
+		for _, s := range d.sources {
+			if s == CSPNonceSource {
+				if nonce == "" {
+					continue
+				}
+				s = "'nonce-" + nonce + "'"
+			}
+			b.WriteString(" ")
+			b.WriteString(s)
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SecurityHeadersConfig selects the headers added to every response
+type SecurityHeadersConfig struct {
+	// Strict-Transport-Security max-age, 0 disables HSTS. Keep it off in dev, browsers remember it.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// X-Frame-Options, CSP frame-ancestors is the modern equivalent but older browsers only know this one
+	FrameOptions            string
+	ReferrerPolicy          string
+	CrossOriginOpenerPolicy string
+	PermissionsPolicy       string
+	// Content-Security-Policy, nil disables it
+	CSP *CSP
+	// Send the policy as Content-Security-Policy-Report-Only to try it out without breaking pages
+	CSPReportOnly bool
+}
+
+// DefaultSecurityHeaders returns a hardened header set with a year of HSTS
+func DefaultSecurityHeaders() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTSMaxAge:              365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		FrameOptions:            "DENY",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy: "same-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=(), payment=()",
+		CSP:                     DefaultCSP(),
+	}
+}
+
+type cspNonceKey struct{}
+
+// CSPNonce returns the nonce of the current request's policy, or "" when the policy has none
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// SecurityHeaders sets the configured headers before calling the handler,
+// handlers can still override them, e.g. to relax the CSP of a single page.
+func SecurityHeaders(conf SecurityHeadersConfig) Middleware {
+	static := http.Header{}
+	static.Set("X-Content-Type-Options", "nosniff")
+	if conf.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.Itoa(int(conf.HSTSMaxAge.Seconds()))
+		if conf.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if conf.HSTSPreload {
+			hsts += "; preload"
+		}
+		static.Set("Strict-Transport-Security", hsts)
+	}
+	if conf.FrameOptions != "" {
+		static.Set("X-Frame-Options", conf.FrameOptions)
+	}
+	if conf.ReferrerPolicy != "" {
+		static.Set("Referrer-Policy", conf.ReferrerPolicy)
+	}
+	if conf.CrossOriginOpenerPolicy != "" {
+		static.Set("Cross-Origin-Opener-Policy", conf.CrossOriginOpenerPolicy)
+	}
+	if conf.PermissionsPolicy != "" {
+		static.Set("Permissions-Policy", conf.PermissionsPolicy)
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if conf.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	// the policy is rendered once unless every request needs its own nonce
+	var csp *CSP
+	fixedCSP := ""
+	if conf.CSP != nil {
+		csp = conf.CSP.Clone()
+		if !csp.UsesNonce() {
+			fixedCSP = csp.String("")
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for k, v := range static {
+				h[k] = slices.Clone(v)
+			}
+			switch {
+			case fixedCSP != "":
+				h.Set(cspHeader, fixedCSP)
+			case csp != nil:
+				nonce := newNonce()
+				h.Set(cspHeader, csp.String(nonce))
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // never fails, see crypto/rand.Read
+	return base64.RawStdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is an application allowed to use this backend as its OpenID provider
+type OAuthClient struct {
+	Id           string   `db:"id"`
+	Name         string   `db:"name"`
+	SecretHash   string   `db:"secret_hash"` // empty for public clients
+	RedirectURIs []string `db:"redirect_uris"`
+	Scopes       []string `db:"scopes"`
+	CreatedAt    int64    `db:"created_at"`
+	UpdatedAt    int64    `db:"updated_at"`
+}
+
+// IsPublic reports whether the client has no secret and relies on PKCE alone
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// OAuthCode is an issued authorization code
+type OAuthCode struct {
+	CodeHash      string    `db:"code_hash"`
+	ClientId      string    `db:"client_id"`
+	UserId        uuid.UUID `db:"user_id"`
+	RedirectURI   string    `db:"redirect_uri"`
+	Scopes        []string  `db:"scopes"`
+	Nonce         string    `db:"nonce"`
+	CodeChallenge string    `db:"code_challenge"` // S256 only
+	AuthTime      time.Time `db:"auth_time"`
+	ExpiresAt     time.Time `db:"expires_at"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// RateLimitState is the stored state of one rate limit key, its meaning depends on the algorithm
+type RateLimitState struct {
+	Value float64   `db:"value"` // tokens left in the bucket, or requests in the current window
+	Prev  float64   `db:"prev"`  // requests in the previous window, sliding window only
+	At    time.Time `db:"at"`    // last refill, or start of the current window. Zero for a new key.
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is a tenant whose users log in through the organization's identity provider
+type Organization struct {
+	Id        uuid.UUID `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt int64     `db:"created_at"`
+	UpdatedAt int64     `db:"updated_at"`
+}
+
+// SSOProtocol enum
+type SSOProtocol string
+
+const (
+	SSOProtocolOIDC SSOProtocol = "oidc"
+	SSOProtocolSAML SSOProtocol = "saml"
+)
+
+// SSOConnection is the identity provider configuration of an organization
+type SSOConnection struct {
+	Id             uuid.UUID   `db:"id"`
+	OrganizationId uuid.UUID   `db:"organization_id"`
+	Protocol       SSOProtocol `db:"protocol"`
+	Enabled        bool        `db:"enabled"`
+
+	// OIDC, the issuer may also be given as its discovery URL
+	OIDCIssuer       string `db:"oidc_issuer"`
+	OIDCClientId     string `db:"oidc_client_id"`
+	OIDCClientSecret string `db:"oidc_client_secret"`
+
+	// SAML, the IdP metadata XML
+	SAMLIDPMetadata string `db:"saml_idp_metadata"`
+
+	CreatedAt int64 `db:"created_at"`
+	UpdatedAt int64 `db:"updated_at"`
+}
+
+// SSOLoginState is a pending sso login, created when the user is sent to the IdP
+type SSOLoginState struct {
+	StateHash    string    `db:"state_hash"`
+	ConnectionId uuid.UUID `db:"connection_id"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	RequestId    string    `db:"request_id"`
+	Audience     string    `db:"audience"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
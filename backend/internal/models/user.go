@@ -7,17 +7,22 @@ type AuthProvider string
 
 const (
 	AuthProviderLocal  AuthProvider = "local"
+	AuthProviderEmail  AuthProvider = "email" // passwordless magic link
+	AuthProviderSSO    AuthProvider = "sso"   // enterprise OIDC/SAML single sign-on
 	AuthProviderGoogle AuthProvider = "google"
 	AuthProviderGithub AuthProvider = "github"
 	// NOTE: add other auth providers as needed
 )
 
 type User struct {
-	Id           uuid.UUID    `db:"id"`
-	Name         string       `db:"name"`
-	Email        string       `db:"email"`
-	PasswordHash string       `db:"password_hash"`
-	AuthProvider AuthProvider `db:"auth_provider"`
-	CreatedAt    int64        `db:"created_at"`
-	UpdatedAt    int64        `db:"updated_at"`
+	Id             uuid.UUID    `db:"id"`
+	Name           string       `db:"name"`
+	Email          string       `db:"email"`
+	EmailVerified  bool         `db:"email_verified"`
+	PasswordHash   string       `db:"password_hash"`
+	AuthProvider   AuthProvider `db:"auth_provider"`
+	OrganizationId *uuid.UUID   `db:"organization_id"` // nil unless provisioned through sso
+	IsAdmin        bool         `db:"is_admin"`
+	CreatedAt      int64        `db:"created_at"`
+	UpdatedAt      int64        `db:"updated_at"`
 }
@@ -0,0 +1,147 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/health"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/mailer"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/router"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/anish-chanda/go-app-starter/migrations"
+	"github.com/rs/zerolog"
+)
+
+// Module is a self-contained feature. A package registers its module from init and main
+// imports the package for its side effect, like database/sql drivers.
+type Module interface {
+	// Name is unique, lowercase letters, digits and underscores. It prefixes the module's
+	// environment variables and names its migration table, so it can't start with the prefix
+	// of core settings (config.ReservedEnvPrefixes) like db or server.
+	Name() string
+	// Init builds the module's services, it runs before anything connects or listens.
+	// Health checks are registered here.
+	Init(deps Deps) error
+	// Routes registers the HTTP endpoints
+	Routes(rt *router.Router, route middleware.Chain)
+}
+
+// Migrator is implemented by modules with their own tables. The migrations are applied after
+// the core ones and versioned in their own table, so modules don't have to coordinate numbers.
+type Migrator interface {
+	Migrations() fs.FS // NNNN_name.up.sql and NNNN_name.down.sql files at the root
+}
+
+// GoMigrator is implemented by Migrator modules that also need migrations written in Go,
+// numbered together with the files of Migrations
+type GoMigrator interface {
+	GoMigrations() []migrations.GoMigration
+}
+
+// Worker is implemented by modules with background jobs
+type Worker interface {
+	Jobs() []Job
+}
+
+// Job runs every Interval until shutdown
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Deps are the shared services a module can use
+type Deps struct {
+	DB     *db.PostgresDB
+	Env    cfg.Env // reads NAME_* variables, e.g. BILLING_API_KEY for module billing
+	Logger *zerolog.Logger
+	Health *health.Registry
+	Mailer mailer.Mailer
+	Tokens *tokens.Service // verifies sessions, for routes that need a logged in user
+}
+
+var (
+	mu      sync.Mutex
+	modules []Module
+	validID = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// Register makes a module known to the app, call it from the module package's init
+func Register(m Module) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := m.Name()
+	if !validID.MatchString(name) {
+		panic(fmt.Sprintf("module: invalid name %q", name))
+	}
+	for _, prefix := range cfg.ReservedEnvPrefixes {
+		if strings.HasPrefix(EnvPrefix(m), prefix) {
+			panic(fmt.Sprintf("module: name %q would read the core %s* settings", name, prefix))
+		}
+	}
+	for _, existing := range modules {
+		if existing.Name() == name {
+			panic(fmt.Sprintf("module: %q registered twice", name))
+		}
+	}
+	modules = append(modules, m)
+}
+
+// All returns the registered modules in registration order
+func All() []Module {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Module(nil), modules...)
+}
+
+// EnvPrefix is the prefix of the module's environment variables
+func EnvPrefix(m Module) string {
+	return strings.ToUpper(m.Name()) + "_"
+}
+
+// MigrationSource returns the migrations of m and whether it has any
+func MigrationSource(m Module) (migrations.Source, bool) {
+	mig, ok := m.(Migrator)
+	if !ok {
+		return migrations.Source{}, false
+	}
+	src := migrations.Source{Name: m.Name(), FS: mig.Migrations(), Table: "schema_migrations_" + m.Name()}
+	if g, ok := m.(GoMigrator); ok {
+		src.Go = g.GoMigrations()
+	}
+	return src, true
+}
+
+// RunJob runs job every interval until ctx is canceled, failures are logged and retried on
+// the next tick
+func RunJob(ctx context.Context, module string, job Job) {
+	l := logger.L().With().Str("module", module).Str("job", job.Name).Logger()
+	if job.Interval <= 0 {
+		l.Error().Msg("Job has no interval, not running it")
+		return
+	}
+	t := time.NewTicker(job.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			start := time.Now()
+			if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+				l.Error().Err(err).Dur("duration", time.Since(start)).Msg("Job failed")
+				continue
+			}
+			l.Debug().Dur("duration", time.Since(start)).Msg("Job finished")
+		}
+	}
+}
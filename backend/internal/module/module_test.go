@@ -0,0 +1,131 @@
+package module
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/router"
+	"github.com/anish-chanda/go-app-starter/migrations"
+	"github.com/jackc/pgx/v5"
+)
+
+type testModule struct{ name string }
+
+func (m testModule) Name() string                            { return m.name }
+func (m testModule) Init(Deps) error                         { return nil }
+func (m testModule) Routes(*router.Router, middleware.Chain) {}
+
+type migratingModule struct{ testModule }
+
+func (migratingModule) Migrations() fs.FS {
+	return fstest.MapFS{"0001_init.up.sql": {Data: []byte("CREATE TABLE t (id int);")}}
+}
+
+type backfillingModule struct{ migratingModule }
+
+func (backfillingModule) GoMigrations() []migrations.GoMigration {
+	return []migrations.GoMigration{{Version: 2, Name: "backfill", Up: func(context.Context, pgx.Tx) error { return nil }}}
+}
+
+func TestRegister(t *testing.T) {
+	defer func(saved []Module) { modules = saved }(modules)
+	modules = nil
+
+	Register(testModule{name: "billing"})
+	Register(migratingModule{testModule{name: "audit_log"}})
+	if got := All(); len(got) != 2 || got[0].Name() != "billing" {
+		t.Errorf("All = %v, want billing then audit_log", got)
+	}
+
+	// billing is taken, the others are invalid or collide with core settings
+	for _, name := range []string{"billing", "Billing", "2fa", "audit-log", "", "db", "admin", "rate_limit", "server_read", "tls"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) didn't panic", name)
+				}
+			}()
+			Register(testModule{name: name})
+		}()
+	}
+}
+
+// TestReservedEnvPrefixes checks that every core setting read by the config loader starts
+// with a reserved prefix, so new settings can't be shadowed by a module
+func TestReservedEnvPrefixes(t *testing.T) {
+	src, err := os.ReadFile("../config/config.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := regexp.MustCompile(`getEnvAs\w+\("([A-Z0-9_]+)"|getRequiredEnvString\("([A-Z0-9_]+)"`).FindAllSubmatch(src, -1)
+	if len(keys) == 0 {
+		t.Fatal("no settings found in config.go")
+	}
+	for _, m := range keys {
+		key := string(m[1]) + string(m[2])
+		if !strings.Contains(key, "_") {
+			continue // module variables always have an underscore after the name
+		}
+		if !slices.ContainsFunc(cfg.ReservedEnvPrefixes, func(p string) bool { return strings.HasPrefix(key, p) }) {
+			t.Errorf("%s has no prefix in config.ReservedEnvPrefixes", key)
+		}
+	}
+}
+
+func TestMigrationSource(t *testing.T) {
+	if _, ok := MigrationSource(testModule{name: "billing"}); ok {
+		t.Error("module without Migrations has a migration source")
+	}
+
+	src, ok := MigrationSource(migratingModule{testModule{name: "audit_log"}})
+	if !ok {
+		t.Fatal("no migration source")
+	}
+	if src.Table != "schema_migrations_audit_log" {
+		t.Errorf("table = %q", src.Table)
+	}
+	if v, err := src.Latest(); err != nil || v != 1 {
+		t.Errorf("Latest = %d, %v, want 1", v, err)
+	}
+	src, _ = MigrationSource(backfillingModule{migratingModule{testModule{name: "audit_log"}}})
+	if v, err := src.Latest(); err != nil || v != 2 {
+		t.Errorf("Latest with Go migrations = %d, %v, want 2", v, err)
+	}
+	if p := EnvPrefix(testModule{name: "audit_log"}); p != "AUDIT_LOG_" {
+		t.Errorf("EnvPrefix = %q", p)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	var runs atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunJob(ctx, "billing", Job{Name: "sync", Interval: time.Millisecond, Run: func(context.Context) error {
+			if runs.Add(1) == 3 {
+				cancel()
+			}
+			return nil
+		}})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunJob didn't return after cancel")
+	}
+	if runs.Load() < 3 {
+		t.Errorf("job ran %d times, want 3", runs.Load())
+	}
+}
@@ -0,0 +1,33 @@
+package hello
+
+import (
+	"net/http"
+
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/module"
+	"github.com/anish-chanda/go-app-starter/internal/router"
+)
+
+// Module is the example module serving /api/hello, copy it to start a new feature
+type Module struct {
+	message string
+}
+
+func init() {
+	module.Register(&Module{})
+}
+
+func (m *Module) Name() string { return "hello" }
+
+func (m *Module) Init(deps module.Deps) error {
+	m.message = deps.Env.String("MESSAGE", "Hello, World!")
+	return nil
+}
+
+func (m *Module) Routes(rt *router.Router, route middleware.Chain) {
+	rt.Handle("GET", "/api/hello", route.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(m.message))
+	})).Summary("Example endpoint").Tags("example").
+		Response(http.StatusOK, "Greeting", "Hello, World!")
+}
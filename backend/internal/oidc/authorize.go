@@ -0,0 +1,368 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const csrfCookieName = "oidc_csrf"
+
+// authRequest holds the authorization request parameters, they are carried through
+// the login and consent forms as hidden fields and validated again on every step
+type authRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+func parseAuthRequest(v url.Values) authRequest {
+	return authRequest{
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		ResponseType:        v.Get("response_type"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		Nonce:               v.Get("nonce"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+		Prompt:              v.Get("prompt"),
+	}
+}
+
+// authError is an OAuth error that is returned to the client through the redirect_uri
+type authError struct {
+	Code        string
+	Description string
+}
+
+func (e *authError) Error() string { return e.Code + ": " + e.Description }
+
+// validate checks the request against the registered client. A non-nil client with an error
+// means the redirect_uri is trusted and the error should be sent back to the client.
+func (p *Provider) validate(ctx context.Context, req authRequest) (*models.OAuthClient, []string, error) {
+	client, err := p.DB.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, errors.New("redirect_uri is not registered for this client")
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, &authError{"unsupported_response_type", "only response_type=code is supported"}
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return client, nil, &authError{"invalid_scope", "the openid scope is required"}
+	}
+	for _, s := range scopes {
+		if !slices.Contains(supportedScopes, s) || !slices.Contains(client.Scopes, s) {
+			return client, nil, &authError{"invalid_scope", "scope " + s + " is not allowed"}
+		}
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return client, nil, &authError{"invalid_request", "PKCE with code_challenge_method=S256 is required"}
+	}
+
+	return client, scopes, nil
+}
+
+// Authorize serves GET /authorize. It shows the login page when there is no session,
+// the consent page when the client wasn't granted the scopes yet, and otherwise
+// redirects straight back to the client with a code.
+func (p *Provider) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthRequest(r.URL.Query())
+	p.handleAuthorize(w, r, req, nil)
+}
+
+// AuthorizeSubmit serves POST /authorize for the login and consent forms
+func (p *Provider) AuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest, "Invalid request.")
+		return
+	}
+	if !checkCSRF(r) {
+		renderError(w, r, http.StatusForbidden, "Your session expired, please go back and try again.")
+		return
+	}
+	req := parseAuthRequest(r.PostForm)
+
+	switch r.PostForm.Get("action") {
+	case "login":
+		user, ok := p.login(w, r)
+		if !ok {
+			p.renderLogin(w, r, req, "Incorrect email or password.")
+			return
+		}
+		// the session cookie was just set, continue with the user we already have
+		p.handleAuthorize(w, r, req, user)
+	case "consent":
+		client, scopes, err := p.validate(ctx, req)
+		if err != nil {
+			p.fail(w, r, req, client, err)
+			return
+		}
+		user, _, err := p.sessionUser(r)
+		if err != nil {
+			p.renderLogin(w, r, req, "")
+			return
+		}
+		if r.PostForm.Get("decision") != "allow" {
+			log.Info().Str("client_id", client.Id).Str("user_id", user.Id.String()).Msg("oidc consent denied")
+			p.redirectError(w, r, req, &authError{"access_denied", "the user denied the request"})
+			return
+		}
+		if err := p.DB.SaveOAuthConsent(ctx, user.Id, client.Id, scopes); err != nil {
+			log.Error().Err(err).Msg("failed to save oidc consent")
+			renderError(w, r, http.StatusInternalServerError, "Something went wrong, please try again.")
+			return
+		}
+		p.issueCode(w, r, req, client, scopes, user, time.Now())
+	default:
+		renderError(w, r, http.StatusBadRequest, "Invalid request.")
+	}
+}
+
+// handleAuthorize runs the authorization steps, user is set when the caller just logged in
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request, req authRequest, user *models.User) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	client, scopes, err := p.validate(ctx, req)
+	if err != nil {
+		p.fail(w, r, req, client, err)
+		return
+	}
+
+	authTime := time.Now()
+	if user == nil {
+		var sessionErr error
+		user, authTime, sessionErr = p.sessionUser(r)
+		if sessionErr != nil || req.Prompt == "login" {
+			if req.Prompt == "none" {
+				p.redirectError(w, r, req, &authError{"login_required", "the user is not logged in"})
+				return
+			}
+			p.renderLogin(w, r, req, "")
+			return
+		}
+	}
+
+	granted, err := p.DB.GetOAuthConsent(ctx, user.Id, client.Id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load oidc consent")
+		renderError(w, r, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	consented := granted != nil && req.Prompt != "consent"
+	for _, s := range scopes {
+		consented = consented && slices.Contains(granted, s)
+	}
+	if !consented {
+		if req.Prompt == "none" {
+			p.redirectError(w, r, req, &authError{"consent_required", "the user has not consented"})
+			return
+		}
+		p.renderConsent(w, r, req, client, scopes, user)
+		return
+	}
+
+	p.issueCode(w, r, req, client, scopes, user, authTime)
+}
+
+// issueCode stores a single-use code and redirects back to the client
+func (p *Provider) issueCode(w http.ResponseWriter, r *http.Request, req authRequest,
+	client *models.OAuthClient, scopes []string, user *models.User, authTime time.Time) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	code, err := authutil.RandomToken()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate authorization code")
+		renderError(w, r, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	err = p.DB.CreateOAuthCode(ctx, models.OAuthCode{
+		CodeHash:      authutil.HashToken(code),
+		ClientId:      client.Id,
+		UserId:        user.Id,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(p.codeTTL()),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to store authorization code")
+		renderError(w, r, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	log.Info().Str("client_id", client.Id).Str("user_id", user.Id.String()).Msg("oidc authorization code issued")
+	p.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// login checks the submitted credentials and starts a regular session on success
+func (p *Provider) login(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	email := strings.TrimSpace(strings.ToLower(r.PostForm.Get("email")))
+	ok, err := p.credChecker.Check(email, r.PostForm.Get("password"))
+	if err != nil || !ok {
+		log.Info().Err(err).Str("email", email).Msg("oidc login failed")
+		return nil, false
+	}
+
+	user, err := p.DB.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Msg("failed to load user after oidc login")
+		return nil, false
+	}
+
+	cid, err := authutil.RandomToken()
+	if err != nil {
+		return nil, false
+	}
+
+	// same shape as the local direct provider, ClaimsUpdater adds uid and provider
+	claims := token.Claims{
+		User: &token.User{
+			Name: email,
+			ID:   string(models.AuthProviderLocal) + "_" + token.HashID(sha1.New(), user.Id.String()),
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       cid,
+			Issuer:   p.Sessions.Issuer,
+			Audience: []string{""},
+		},
+		AuthProvider: &token.AuthProvider{Name: string(models.AuthProviderLocal)},
+	}
+	if _, err := p.Sessions.Set(w, claims); err != nil {
+		log.Error().Err(err).Msg("failed to set session after oidc login")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// sessionUser loads the logged-in user from the session cookie
+func (p *Provider) sessionUser(r *http.Request) (*models.User, time.Time, error) {
+	claims, err := p.Sessions.GetFromCookie(r)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	id, err := uuid.Parse(claims.User.StrAttr("uid"))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	user, err := p.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	authTime := time.Now()
+	if claims.IssuedAt != nil {
+		authTime = claims.IssuedAt.Time
+	}
+	return user, authTime, nil
+}
+
+// fail reports a validation error, only redirecting when the redirect_uri is trusted
+func (p *Provider) fail(w http.ResponseWriter, r *http.Request, req authRequest, client *models.OAuthClient, err error) {
+	var aerr *authError
+	if client != nil && errors.As(err, &aerr) {
+		p.redirectError(w, r, req, aerr)
+		return
+	}
+	if errors.Is(err, db.ErrOAuthClientNotFound) {
+		renderError(w, r, http.StatusBadRequest, "Unknown application.")
+		return
+	}
+	logger.Ctx(r.Context()).Warn().Err(err).Str("client_id", req.ClientID).Msg("invalid oidc authorization request")
+	renderError(w, r, http.StatusBadRequest, "Invalid authorization request.")
+}
+
+func (p *Provider) redirectError(w http.ResponseWriter, r *http.Request, req authRequest, aerr *authError) {
+	p.redirect(w, r, req, url.Values{"error": {aerr.Code}, "error_description": {aerr.Description}})
+}
+
+// redirect sends the browser back to the validated redirect_uri with params, state and iss
+func (p *Provider) redirect(w http.ResponseWriter, r *http.Request, req authRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, "Invalid redirect_uri.")
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	q.Set("iss", p.Issuer) // RFC 9207
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// csrfToken returns the double-submit token for the forms, setting the cookie if needed
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	tkn, err := authutil.RandomToken()
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    tkn,
+		Path:     "/authorize",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return tkn
+}
+
+// checkCSRF compares the form token with the cookie
+func checkCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostForm.Get("csrf"))) == 1
+}
@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/go-pkgz/auth/v2/provider"
+)
+
+// Supported scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var supportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// Provider is an OpenID Connect provider backed by the users table and local login.
+// Only the authorization code flow with PKCE (S256) is supported.
+//
+//	GET  /.well-known/openid-configuration  discovery document
+//	GET  /authorize                         login and consent pages
+//	POST /authorize                         login and consent form submissions
+//	POST /token                             code exchange
+//	GET  /userinfo                          claims for an access token
+type Provider struct {
+	DB       *db.PostgresDB
+	Sessions *tokens.Service // browser session shared with /auth
+	Keys     *tokens.KeySet  // signs ID and access tokens with the asymmetric OIDC key
+	Issuer   string
+
+	conf        cfg.OIDCConfig
+	credChecker provider.CredChecker
+}
+
+// New creates the provider. The OIDC signing key must be an asymmetric key with a private part
+// so relying parties can verify ID tokens through the JWKS endpoint.
+func New(conf cfg.OIDCConfig, issuer string, database *db.PostgresDB, sessions *tokens.Service,
+	credChecker provider.CredChecker) (*Provider, error) {
+	if conf.SigningKeyID == "" {
+		return nil, fmt.Errorf("OIDC_SIGNING_KID is required when OIDC is enabled")
+	}
+
+	keys, err := sessions.Keys.WithSigningKey(conf.SigningKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("oidc signing key: %w", err)
+	}
+	if keys.SigningKey().IsSymmetric() {
+		return nil, fmt.Errorf("oidc signing key %q must be asymmetric (RS256, ES256 or EdDSA)", conf.SigningKeyID)
+	}
+
+	return &Provider{
+		DB:          database,
+		Sessions:    sessions,
+		Keys:        keys,
+		Issuer:      strings.TrimSuffix(issuer, "/"),
+		conf:        conf,
+		credChecker: credChecker,
+	}, nil
+}
+
+// discovery is the OpenID Provider Metadata document
+type discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery serves GET /.well-known/openid-configuration
+func (p *Provider) Discovery(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	request.WriteJSON(w, http.StatusOK, discovery{
+		Issuer:                            p.Issuer,
+		AuthorizationEndpoint:             p.Issuer + "/authorize",
+		TokenEndpoint:                     p.Issuer + "/token",
+		UserinfoEndpoint:                  p.Issuer + "/userinfo",
+		JWKSURI:                           p.Issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   supportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{p.Keys.SigningKey().Algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "email", "email_verified"},
+	})
+}
+
+// userClaims returns the scoped user claims shared by the ID token and /userinfo
+func userClaims(user *models.User, scopes []string) map[string]any {
+	claims := map[string]any{"sub": user.Id.String()}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = user.Name
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+// pkceS256 derives the S256 code challenge from a verifier (RFC 7636)
+func pkceS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) codeTTL() time.Duration {
+	return time.Duration(p.conf.CodeTTL) * time.Minute
+}
+
+func (p *Provider) tokenTTL() time.Duration {
+	return time.Duration(p.conf.AccessTokenTTL) * time.Minute
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestProvider(t *testing.T, signingKid string) (*Provider, error) {
+	t.Helper()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	edKey, err := tokens.ParseKey("ed-1", tokens.AlgEdDSA, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseKey() error = %v", err)
+	}
+	hmacKey := tokens.NewHMACKey("secret")
+	ks, err := tokens.NewKeySet(hmacKey.ID, hmacKey, edKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	sessions := tokens.NewService(token.NewService(token.Opts{}), ks)
+	conf := cfg.OIDCConfig{Enabled: true, SigningKeyID: signingKid, CodeTTL: 5, AccessTokenTTL: 60}
+	return New(conf, "https://id.example.com/", nil, sessions, nil)
+}
+
+func TestNewRequiresAsymmetricKey(t *testing.T) {
+	if _, err := newTestProvider(t, ""); err == nil {
+		t.Errorf("New() expected error without signing kid")
+	}
+	if _, err := newTestProvider(t, tokens.NewHMACKey("secret").ID); err == nil {
+		t.Errorf("New() expected error for HMAC signing key")
+	}
+	if _, err := newTestProvider(t, "ed-1"); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+}
+
+func TestPKCES256(t *testing.T) {
+	// BASE64URL(SHA256(verifier)) without padding
+	verifier := strings.Repeat("a", 43)
+	want := "ZtNPunH49FD35FWYhT5Tv8I7vRKQJ8uxMaL0_9eHjNA"
+
+	if got := pkceS256(verifier); got != want {
+		t.Errorf("pkceS256() = %q, want %q", got, want)
+	}
+}
+
+func TestIssueTokens(t *testing.T) {
+	p, err := newTestProvider(t, "ed-1")
+	if err != nil {
+		t.Fatalf("newTestProvider() error = %v", err)
+	}
+
+	user := &models.User{Id: uuid.New(), Name: "Test", Email: "test@example.com", EmailVerified: true}
+	client := &models.OAuthClient{Id: "wiki"}
+	code := &models.OAuthCode{Scopes: []string{ScopeOpenID, ScopeEmail}, Nonce: "n-1", AuthTime: time.Now()}
+
+	resp, err := p.issueTokens(client, code, user)
+	if err != nil {
+		t.Fatalf("issueTokens() error = %v", err)
+	}
+
+	var id idClaims
+	parser := jwt.NewParser(jwt.WithIssuer(p.Issuer), jwt.WithAudience("wiki"), jwt.WithValidMethods([]string{tokens.AlgEdDSA}))
+	idToken, err := parser.ParseWithClaims(resp.IDToken, &id, p.Keys.Keyfunc)
+	if err != nil {
+		t.Fatalf("ParseWithClaims(id_token) error = %v", err)
+	}
+	if idToken.Header["kid"] != "ed-1" {
+		t.Errorf("id_token kid = %v, want ed-1", idToken.Header["kid"])
+	}
+	if id.Subject != user.Id.String() || id.Nonce != "n-1" || id.Email != user.Email || id.Name != "" {
+		t.Errorf("id_token claims = %+v, want scoped user claims", id)
+	}
+
+	// the access token is accepted by /userinfo, which needs a db to load the user,
+	// so only check that the typ header sets it apart from session and ID tokens
+	at, _, err := jwt.NewParser().ParseUnverified(resp.AccessToken, &accessClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified(access_token) error = %v", err)
+	}
+	if at.Header["typ"] != accessTokenType {
+		t.Errorf("access_token typ = %v, want %s", at.Header["typ"], accessTokenType)
+	}
+}
+
+func TestUserInfoRejectsIDToken(t *testing.T) {
+	p, err := newTestProvider(t, "ed-1")
+	if err != nil {
+		t.Fatalf("newTestProvider() error = %v", err)
+	}
+
+	user := &models.User{Id: uuid.New()}
+	resp, err := p.issueTokens(&models.OAuthClient{Id: "wiki"}, &models.OAuthCode{Scopes: []string{ScopeOpenID}}, user)
+	if err != nil {
+		t.Fatalf("issueTokens() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.IDToken)
+	rec := httptest.NewRecorder()
+	p.UserInfo(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("UserInfo() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	p, err := newTestProvider(t, "ed-1")
+	if err != nil {
+		t.Fatalf("newTestProvider() error = %v", err)
+	}
+
+	req := authRequest{RedirectURI: "https://wiki.example.com/cb?tenant=1", State: "xyz"}
+	rec := httptest.NewRecorder()
+	p.redirect(rec, httptest.NewRequest(http.MethodGet, "/authorize", nil), req, url.Values{"code": {"abc"}})
+
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location: %v", err)
+	}
+	q := loc.Query()
+	if q.Get("tenant") != "1" || q.Get("code") != "abc" || q.Get("state") != "xyz" || q.Get("iss") != p.Issuer {
+		t.Errorf("redirect query = %v, want tenant, code, state and iss", q)
+	}
+}
@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+)
+
+// NOTE: the pages are intentionally plain, restyle them to match your app
+
+const layout = `{{define "layout"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style nonce="{{.Nonce}}">
+body { font-family: system-ui, sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+input, button { display: block; width: 100%; margin: .5rem 0; padding: .5rem; box-sizing: border-box; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>{{template "content" .}}</body>
+</html>{{end}}`
+
+const hiddenFields = `{{define "hidden"}}
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Req.Scope}}">
+<input type="hidden" name="state" value="{{.Req.State}}">
+<input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+{{end}}`
+
+var (
+	loginTmpl = template.Must(template.New("login").Parse(layout + hiddenFields + `{{define "content"}}
+<h1>Sign in</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+{{template "hidden" .}}
+<input type="hidden" name="action" value="login">
+<input type="email" name="email" placeholder="Email" autocomplete="username" required autofocus>
+<input type="password" name="password" placeholder="Password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form>
+{{end}}`))
+
+	consentTmpl = template.Must(template.New("consent").Parse(layout + hiddenFields + `{{define "content"}}
+<h1>{{.Client.Name}}</h1>
+<p>{{.Client.Name}} wants to access your account <strong>{{.User.Email}}</strong>:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/authorize">
+{{template "hidden" .}}
+<input type="hidden" name="action" value="consent">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+{{end}}`))
+
+	errorTmpl = template.Must(template.New("error").Parse(layout + `{{define "content"}}
+<h1>Sign in failed</h1>
+<p class="error">{{.Error}}</p>
+{{end}}`))
+)
+
+// scopeDescriptions are shown on the consent page
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:  "Your account identifier",
+	ScopeProfile: "Your name",
+	ScopeEmail:   "Your email address",
+}
+
+type pageData struct {
+	Title  string
+	Nonce  string // CSP nonce of the inline style
+	Error  string
+	CSRF   string
+	Req    authRequest
+	Client *models.OAuthClient
+	User   *models.User
+	Scopes []string
+}
+
+func (p *Provider) renderLogin(w http.ResponseWriter, r *http.Request, req authRequest, errMsg string) {
+	status := http.StatusOK
+	if errMsg != "" {
+		status = http.StatusUnauthorized
+	}
+	render(w, r, status, loginTmpl, pageData{Title: "Sign in", Error: errMsg, CSRF: csrfToken(w, r), Req: req})
+}
+
+func (p *Provider) renderConsent(w http.ResponseWriter, r *http.Request, req authRequest,
+	client *models.OAuthClient, scopes []string, user *models.User) {
+	descriptions := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		descriptions = append(descriptions, scopeDescriptions[s])
+	}
+	render(w, r, http.StatusOK, consentTmpl, pageData{
+		Title:  "Authorize " + client.Name,
+		CSRF:   csrfToken(w, r),
+		Req:    req,
+		Client: client,
+		User:   user,
+		Scopes: descriptions,
+	})
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	render(w, r, status, errorTmpl, pageData{Title: "Error", Error: msg})
+}
+
+func render(w http.ResponseWriter, r *http.Request, status int, tmpl *template.Template, data pageData) {
+	data.Nonce = middleware.CSPNonce(r.Context())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the pages must never be framed, that would allow clickjacking the consent
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	_ = tmpl.ExecuteTemplate(w, "layout", data)
+}
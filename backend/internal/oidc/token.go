@@ -0,0 +1,261 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const accessTokenType = "at+jwt" // RFC 9068
+
+// accessClaims are the claims of an access token, only accepted by /userinfo
+type accessClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+}
+
+// idClaims are the claims of an ID token
+type idClaims struct {
+	jwt.RegisteredClaims
+	AuthTime      int64  `json:"auth_time"`
+	Nonce         string `json:"nonce,omitempty"`
+	AZP           string `json:"azp"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Token serves POST /token, exchanging an authorization code for ID and access tokens
+func (p *Provider) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"invalid_request", "malformed form body"})
+		return
+	}
+	if gt := r.PostForm.Get("grant_type"); gt != "authorization_code" {
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"unsupported_grant_type", "only authorization_code is supported"})
+		return
+	}
+
+	client, ok := p.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	code, err := p.DB.ConsumeOAuthCode(ctx, authutil.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		if !errors.Is(err, db.ErrOAuthCodeInvalid) {
+			log.Error().Err(err).Msg("failed to consume authorization code")
+		}
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"invalid_grant", "authorization code is invalid or expired"})
+		return
+	}
+
+	if code.ClientId != client.Id || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		log.Warn().Str("client_id", client.Id).Msg("authorization code presented by the wrong client or redirect_uri")
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"invalid_grant", "authorization code was not issued to this client"})
+		return
+	}
+
+	verifier := r.PostForm.Get("code_verifier")
+	if len(verifier) < 43 || len(verifier) > 128 ||
+		subtle.ConstantTimeCompare([]byte(pkceS256(verifier)), []byte(code.CodeChallenge)) != 1 {
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"invalid_grant", "code_verifier does not match"})
+		return
+	}
+
+	user, err := p.DB.GetUserByID(ctx, code.UserId)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", code.UserId.String()).Msg("failed to load user for token exchange")
+		request.WriteJSON(w, http.StatusBadRequest, tokenError{"invalid_grant", "user no longer exists"})
+		return
+	}
+
+	resp, err := p.issueTokens(client, code, user)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to sign oidc tokens")
+		request.WriteJSON(w, http.StatusInternalServerError, tokenError{"server_error", ""})
+		return
+	}
+
+	log.Info().Str("client_id", client.Id).Str("user_id", user.Id.String()).Msg("oidc tokens issued")
+	request.WriteJSON(w, http.StatusOK, resp)
+}
+
+// authenticateClient supports client_secret_basic, client_secret_post and none (public clients)
+func (p *Provider) authenticateClient(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	unauthorized := func() (*models.OAuthClient, bool) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		request.WriteJSON(w, http.StatusUnauthorized, tokenError{"invalid_client", "client authentication failed"})
+		return nil, false
+	}
+
+	client, err := p.DB.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if !errors.Is(err, db.ErrOAuthClientNotFound) {
+			logger.Ctx(r.Context()).Error().Err(err).Msg("failed to load oauth client")
+		}
+		return unauthorized()
+	}
+
+	if client.IsPublic() {
+		if secret != "" {
+			return unauthorized()
+		}
+		return client, true
+	}
+	if subtle.ConstantTimeCompare([]byte(authutil.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return unauthorized()
+	}
+	return client, true
+}
+
+// issueTokens signs the access and ID tokens for an exchanged code
+func (p *Provider) issueTokens(client *models.OAuthClient, code *models.OAuthCode, user *models.User) (*tokenResponse, error) {
+	now := time.Now()
+	exp := now.Add(p.tokenTTL())
+
+	jti, err := authutil.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	scope := strings.Join(code.Scopes, " ")
+	accessToken, err := p.Keys.SignWithType(accessTokenType, accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    p.Issuer,
+			Subject:   user.Id.String(),
+			Audience:  jwt.ClaimStrings{p.Issuer + "/userinfo"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		ClientID: client.Id,
+		Scope:    scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	id := idClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Issuer,
+			Subject:   user.Id.String(),
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		AuthTime: code.AuthTime.Unix(),
+		Nonce:    code.Nonce,
+		AZP:      client.Id,
+	}
+	if slices.Contains(code.Scopes, ScopeProfile) {
+		id.Name = user.Name
+	}
+	if slices.Contains(code.Scopes, ScopeEmail) {
+		id.Email = user.Email
+		id.EmailVerified = &user.EmailVerified
+	}
+	idToken, err := p.Keys.Sign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.tokenTTL().Seconds()),
+		IDToken:     idToken,
+		Scope:       scope,
+	}, nil
+}
+
+// UserInfo serves GET /userinfo for a bearer access token
+func (p *Provider) UserInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	invalid := func(desc string) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+desc+`"`)
+		request.WriteJSON(w, http.StatusUnauthorized, tokenError{"invalid_token", desc})
+	}
+
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		request.WriteJSON(w, http.StatusUnauthorized, tokenError{"invalid_request", "bearer token required"})
+		return
+	}
+
+	var claims accessClaims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(p.Keys.Algorithms()),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.Issuer+"/userinfo"),
+		jwt.WithExpirationRequired(),
+	)
+	t, err := parser.ParseWithClaims(raw, &claims, p.Keys.Keyfunc)
+	if err != nil || t.Header["typ"] != accessTokenType {
+		invalid("access token is invalid or expired")
+		return
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		invalid("access token lacks the openid scope")
+		return
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		invalid("access token subject is invalid")
+		return
+	}
+	user, err := p.DB.GetUserByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) {
+			logger.Ctx(ctx).Error().Err(err).Msg("failed to load user for userinfo")
+		}
+		invalid("user no longer exists")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	request.WriteJSON(w, http.StatusOK, userClaims(user, scopes))
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/models"
+)
+
+// MemoryStore keeps rate limit state in the process, limits are per replica and reset on restart
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	state     models.RateLimitState
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty store, run RunCleanup to drop idle keys
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}, now: time.Now}
+}
+
+func (s *MemoryStore) UpdateRateLimit(_ context.Context, key string, expiresAt time.Time, fn func(models.RateLimitState) models.RateLimitState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state models.RateLimitState
+	if e, ok := s.entries[key]; ok && e.expiresAt.After(s.now()) {
+		state = e.state
+	}
+	s.entries[key] = memoryEntry{state: fn(state), expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredRateLimits(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var n int64
+	for key, e := range s.entries {
+		if !e.expiresAt.After(now) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,309 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/clientip"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/go-pkgz/auth/v2/token"
+)
+
+// CodeRateLimited is the problem code of a 429 response
+const CodeRateLimited = "rate_limited"
+
+// Algorithm decides how requests are counted
+type Algorithm int
+
+const (
+	// TokenBucket refills Requests tokens per Window up to Burst, so short bursts are allowed
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Requests per Window, weighing the previous window by how much of it
+	// still overlaps. It is stricter than a bucket and doesn't reset at window boundaries.
+	SlidingWindow
+)
+
+// Limit is the quota of a single key
+type Limit struct {
+	Requests  int
+	Window    time.Duration
+	Algorithm Algorithm
+	// Bucket size of TokenBucket, 0 means Requests
+	Burst int
+}
+
+// PerMinute allows n requests a minute with a token bucket of the same size
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Window: time.Minute}
+}
+
+// PerHour allows n requests an hour with a token bucket of the same size
+func PerHour(n int) Limit {
+	return Limit{Requests: n, Window: time.Hour}
+}
+
+// quota is the number of requests a fresh key may make at once
+func (l Limit) quota() float64 {
+	if l.Algorithm == TokenBucket && l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// ttl is how long the state of an idle key matters, after that it is as good as new
+func (l Limit) ttl() time.Duration {
+	if l.Algorithm == SlidingWindow {
+		return 2 * l.Window
+	}
+	return time.Duration(l.quota() / float64(l.Requests) * float64(l.Window))
+}
+
+// Result is the outcome of counting one request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the full quota is available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, 0 when allowed
+	RetryAfter time.Duration
+}
+
+// take counts one request against state s at now
+func (l Limit) take(s models.RateLimitState, now time.Time) (models.RateLimitState, Result) {
+	if l.Algorithm == SlidingWindow {
+		return l.takeWindow(s, now)
+	}
+	return l.takeBucket(s, now)
+}
+
+func (l Limit) takeBucket(s models.RateLimitState, now time.Time) (models.RateLimitState, Result) {
+	capacity := l.quota()
+	perSecond := float64(l.Requests) / l.Window.Seconds()
+
+	tokens := capacity
+	if !s.At.IsZero() {
+		elapsed := max(now.Sub(s.At).Seconds(), 0)
+		tokens = min(capacity, s.Value+elapsed*perSecond)
+	}
+
+	res := Result{Limit: int(capacity)}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / perSecond)
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = seconds((capacity - tokens) / perSecond)
+	return models.RateLimitState{Value: tokens, At: now}, res
+}
+
+func (l Limit) takeWindow(s models.RateLimitState, now time.Time) (models.RateLimitState, Result) {
+	start := now.Truncate(l.Window)
+	switch {
+	case s.At.Equal(start):
+	case s.At.Equal(start.Add(-l.Window)):
+		s = models.RateLimitState{Prev: s.Value, At: start}
+	default:
+		s = models.RateLimitState{At: start}
+	}
+
+	limit := float64(l.Requests)
+	elapsed := now.Sub(start)
+	// share of the previous window that still overlaps the sliding window ending now
+	weight := 1 - float64(elapsed)/float64(l.Window)
+	used := s.Prev*weight + s.Value
+
+	res := Result{Limit: l.Requests}
+	switch {
+	case used+1 <= limit:
+		s.Value++
+		used++
+		res.Allowed = true
+	case s.Value+1 <= limit:
+		// wait until enough of the previous window has slid out
+		free := 1 - (limit-1-s.Value)/s.Prev
+		res.RetryAfter = max(time.Duration(free*float64(l.Window))-elapsed, 0)
+	default:
+		// this window is used up, it becomes the previous one and has to slide out as well
+		free := 1 - (limit-1)/s.Value
+		res.RetryAfter = l.Window - elapsed + time.Duration(free*float64(l.Window))
+	}
+	// requests count until the window after theirs is over
+	switch {
+	case s.Value > 0:
+		res.Reset = 2*l.Window - elapsed
+	case s.Prev > 0:
+		res.Reset = l.Window - elapsed
+	}
+	res.Remaining = max(int(math.Floor(limit-used)), 0)
+	return s, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps the state of every key, shared by all replicas for limits that must hold globally.
+// The database implements it with a table, MemoryStore keeps the state in the process.
+type Store interface {
+	// UpdateRateLimit calls fn with the current state of key, the zero state for a new or
+	// expired key, and saves the result until expiresAt. Concurrent updates of a key are serialized.
+	UpdateRateLimit(ctx context.Context, key string, expiresAt time.Time, fn func(models.RateLimitState) models.RateLimitState) error
+	// DeleteExpiredRateLimits drops keys past their expiry
+	DeleteExpiredRateLimits(ctx context.Context) (int64, error)
+}
+
+// Limiter counts requests in a Store
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+// New creates a limiter backed by store
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow counts one request for key
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := l.now()
+	var res Result
+	err := l.store.UpdateRateLimit(ctx, key, now.Add(limit.ttl()), func(s models.RateLimitState) models.RateLimitState {
+		next, r := limit.take(s, now)
+		res = r
+		return next
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// KeyFunc returns what a request is counted by, ok is false to leave the request unlimited
+type KeyFunc func(r *http.Request) (key string, ok bool)
+
+// Middleware limits requests per key, name keeps the counters of different routes apart.
+// Responses carry the RateLimit-Limit, -Remaining, -Reset and -Policy headers of the
+// IETF draft, rejected requests get a 429 with Retry-After. If the store fails the
+// request is let through, a broken database shouldn't take logins down with it.
+// A nil limiter doesn't limit anything, so routes can declare limits unconditionally.
+func (l *Limiter) Middleware(name string, limit Limit, key KeyFunc) middleware.Middleware {
+	policy := fmt.Sprintf("%d;w=%d", int(limit.quota()), int(limit.Window.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, ok := key(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := l.Allow(r.Context(), name+":"+k, limit)
+			if err != nil {
+				logger.Ctx(r.Context()).Warn().Err(err).Str("limit", name).Msg("rate limit store failed, allowing request")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			h.Set("RateLimit-Policy", policy)
+			if !res.Allowed {
+				h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				logger.Ctx(r.Context()).Info().Str("limit", name).Msg("rate limit exceeded")
+				apperr.Write(w, r, &apperr.Error{
+					Status:  http.StatusTooManyRequests,
+					Code:    CodeRateLimited,
+					Message: "too many requests, try again later",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RunCleanup deletes expired keys every interval until ctx is canceled
+func RunCleanup(ctx context.Context, store Store, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := store.DeleteExpiredRateLimits(ctx)
+			if err != nil {
+				logger.L().Warn().Err(err).Msg("failed to delete expired rate limits")
+				continue
+			}
+			if n > 0 {
+				logger.L().Debug().Int64("deleted", n).Msg("deleted expired rate limits")
+			}
+		}
+	}
+}
+
+// ByIP counts requests per client IP, as resolved by clientip behind trusted proxies
+func ByIP(r *http.Request) (string, bool) {
+	ip := clientip.FromRequest(r)
+	return "ip:" + ip, ip != ""
+}
+
+// ByUser counts requests per logged in user, anonymous requests aren't counted
+func ByUser(tokens interface {
+	Get(r *http.Request) (token.Claims, string, error)
+}) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		claims, _, err := tokens.Get(r)
+		if err != nil || claims.User == nil || claims.User.ID == "" {
+			return "", false
+		}
+		return "user:" + claims.User.ID, true
+	}
+}
+
+// ByAPIKey counts requests per API key sent in header, keys are hashed before they are stored
+func ByAPIKey(header string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		v := strings.TrimSpace(r.Header.Get(header))
+		if v == "" {
+			return "", false
+		}
+		sum := sha256.Sum256([]byte(v))
+		return "key:" + hex.EncodeToString(sum[:16]), true
+	}
+}
+
+// FirstOf uses the first key func that has a key, e.g. FirstOf(ByUser(tokens), ByIP)
+func FirstOf(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		for _, key := range keys {
+			if k, ok := key(r); ok {
+				return k, true
+			}
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is shared by the limiter and the store
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter() (*Limiter, *MemoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = clock.now
+	l := New(store)
+	l.now = clock.now
+	return l, store, clock
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, _, clock := newTestLimiter()
+	limit := Limit{Requests: 6, Window: time.Minute, Burst: 3} // a token every 10s
+	ctx := context.Background()
+
+	steps := []struct {
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{wantAllowed: true, wantRemaining: 2},
+		{wantAllowed: true, wantRemaining: 1},
+		{wantAllowed: true, wantRemaining: 0},
+		{wantAllowed: false, wantRemaining: 0, wantRetry: 10 * time.Second},
+		{advance: 4 * time.Second, wantAllowed: false, wantRemaining: 0, wantRetry: 6 * time.Second},
+		{advance: 6 * time.Second, wantAllowed: true, wantRemaining: 0},
+		// refilled to the burst, not beyond
+		{advance: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+	for i, s := range steps {
+		clock.t = clock.t.Add(s.advance)
+		res, err := l.Allow(ctx, "k", limit)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if res.Allowed != s.wantAllowed || res.Remaining != s.wantRemaining || res.Limit != 3 {
+			t.Errorf("step %d: allowed %v remaining %d limit %d, want %v %d 3", i, res.Allowed, res.Remaining, res.Limit, s.wantAllowed, s.wantRemaining)
+		}
+		if res.RetryAfter.Round(time.Millisecond) != s.wantRetry {
+			t.Errorf("step %d: retry after %v, want %v", i, res.RetryAfter, s.wantRetry)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l, _, clock := newTestLimiter()
+	limit := Limit{Requests: 4, Window: time.Minute, Algorithm: SlidingWindow}
+	ctx := context.Background()
+
+	take := func(n int) (allowed int, last Result) {
+		for range n {
+			res, err := l.Allow(ctx, "k", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed {
+				allowed++
+			}
+			last = res
+		}
+		return allowed, last
+	}
+
+	if got, res := take(5); got != 4 || res.Allowed {
+		t.Fatalf("first window allowed %d, want 4", got)
+	} else if res.RetryAfter != 75*time.Second {
+		// the window has to end and then a quarter of it has to slide out to free one request
+		t.Errorf("retry after %v, want 1m15s", res.RetryAfter)
+	}
+
+	// a quarter into the next window the previous one still counts for 3 requests
+	clock.t = clock.t.Add(75 * time.Second)
+	if got, _ := take(2); got != 1 {
+		t.Errorf("after 75s allowed %d, want 1", got)
+	}
+
+	// two windows later nothing counts anymore
+	clock.t = clock.t.Add(2 * time.Minute)
+	if got, res := take(4); got != 4 || res.Remaining != 0 {
+		t.Errorf("fresh window allowed %d remaining %d, want 4 and 0", got, res.Remaining)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _, clock := newTestLimiter()
+	h := l.Middleware("test", PerMinute(2), ByIP)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+		rec := do("192.0.2.1:1234")
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, want)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("request %d: headers %v", i, rec.Header())
+		}
+	}
+
+	rec := do("192.0.2.1:5678")
+	if rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Retry-After %q Remaining %q, want 30 and 0", rec.Header().Get("Retry-After"), rec.Header().Get("RateLimit-Remaining"))
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want a problem", ct)
+	}
+
+	// other clients have their own quota
+	if rec := do("198.51.100.7:1234"); rec.Code != http.StatusNoContent {
+		t.Errorf("other client: status %d", rec.Code)
+	}
+
+	clock.t = clock.t.Add(30 * time.Second)
+	if rec := do("192.0.2.1:1234"); rec.Code != http.StatusNoContent {
+		t.Errorf("after refill: status %d", rec.Code)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	h := l.Middleware("test", PerMinute(1), ByIP)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for range 3 {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("nil limiter limited the request: %d %v", rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[2001:db8::1]:443"
+
+	if k, ok := ByIP(req); !ok || k != "ip:2001:db8::1" {
+		t.Errorf("ByIP = %q %v", k, ok)
+	}
+	if _, ok := ByAPIKey("X-Api-Key")(req); ok {
+		t.Error("ByAPIKey without a header should not match")
+	}
+
+	req.Header.Set("X-Api-Key", "secret")
+	k, ok := FirstOf(ByAPIKey("X-Api-Key"), ByIP)(req)
+	if !ok || len(k) != len("key:")+32 || k == "key:secret" {
+		t.Errorf("FirstOf = %q %v, want the hashed api key", k, ok)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	l, store, clock := newTestLimiter()
+	ctx := context.Background()
+	limit := PerMinute(1)
+
+	if res, _ := l.Allow(ctx, "k", limit); !res.Allowed {
+		t.Fatal("first request denied")
+	}
+	if n, _ := store.DeleteExpiredRateLimits(ctx); n != 0 {
+		t.Errorf("deleted %d live keys", n)
+	}
+	clock.t = clock.t.Add(time.Minute)
+	if n, _ := store.DeleteExpiredRateLimits(ctx); n != 1 {
+		t.Errorf("deleted %d keys, want 1", n)
+	}
+}
@@ -0,0 +1,132 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+)
+
+// DefaultMaxBytes is the body limit used by Decode
+const DefaultMaxBytes = 1 << 20 // 1 MiB
+
+// problem codes returned while decoding
+const (
+	CodeInvalidBody          = "invalid_body"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+)
+
+// Validator can be implemented by request types for checks struct tags can't express.
+// It runs after the tag rules and its field errors are reported together with theirs.
+type Validator interface {
+	Validate() []apperr.FieldError
+}
+
+// Decode reads a JSON request body into T and validates it, see DecodeLimit
+func Decode[T any](w http.ResponseWriter, r *http.Request) (T, error) {
+	return DecodeLimit[T](w, r, DefaultMaxBytes)
+}
+
+// DecodeLimit reads a JSON request body of at most maxBytes into T. Unknown fields,
+// trailing data and non-JSON content types are rejected, then the `validate` struct tags
+// and the Validator method run. Errors are *apperr.Error and can be passed to apperr.Write.
+func DecodeLimit[T any](w http.ResponseWriter, r *http.Request, maxBytes int64) (T, error) {
+	var v T
+
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return v, &apperr.Error{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    CodeUnsupportedMediaType,
+			Message: "content type must be application/json",
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return v, decodeError(err)
+		}
+		return v, apperr.BadRequest(CodeInvalidBody, "request body must contain a single JSON value")
+	}
+
+	fields := Validate(v)
+	if val, ok := any(&v).(Validator); ok {
+		fields = append(fields, val.Validate()...)
+	}
+	if len(fields) > 0 {
+		return v, apperr.Validation(fields...)
+	}
+	return v, nil
+}
+
+// isJSON accepts application/json and structured syntax suffixes like application/merge-patch+json
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || (strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json"))
+}
+
+// decodeError maps json and body limit errors to client errors
+func decodeError(err error) *apperr.Error {
+	var (
+		tooLarge   *http.MaxBytesError
+		syntaxErr  *json.SyntaxError
+		typeErr    *json.UnmarshalTypeError
+		unknownKey = "json: unknown field "
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return &apperr.Error{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    CodeBodyTooLarge,
+			Message: fmt.Sprintf("request body must not be larger than %d bytes", tooLarge.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return apperr.BadRequest(CodeInvalidBody, "request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntaxErr):
+		return apperr.BadRequest(CodeInvalidBody, "request body is not valid JSON")
+	case errors.As(err, &typeErr):
+		return apperr.Validation(apperr.FieldError{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type.Kind().String())),
+		})
+	case strings.HasPrefix(err.Error(), unknownKey):
+		// encoding/json has no typed error for this one
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownKey), `"`)
+		return apperr.Validation(apperr.FieldError{
+			Field:   field,
+			Code:    "unknown",
+			Message: fmt.Sprintf("unknown field %s", field),
+		})
+	}
+	return apperr.BadRequest(CodeInvalidBody, "invalid request")
+}
+
+// jsonType names a Go kind the way a client would think of it
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "struct", kind == "map":
+		return "object"
+	}
+	return kind
+}
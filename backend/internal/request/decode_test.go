@@ -0,0 +1,209 @@
+package request
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+)
+
+type testRequest struct {
+	Name  string   `json:"name" validate:"required,max=5"`
+	Email string   `json:"email" validate:"email"`
+	Role  string   `json:"role" validate:"oneof=admin member"`
+	Age   int      `json:"age" validate:"min=18"`
+	Tags  []string `json:"tags" validate:"max=2"`
+}
+
+func (r testRequest) Validate() []apperr.FieldError {
+	if r.Role == "admin" && r.Age < 21 {
+		return []apperr.FieldError{{Field: "age", Code: "invalid", Message: "admins must be at least 21"}}
+	}
+	return nil
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		limit       int64
+		wantStatus  int
+		wantCode    string
+		wantFields  []string
+	}{
+		{
+			name:        "valid",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"ann","email":"ann@example.com","role":"member","age":30}`,
+		},
+		{
+			name:        "optional fields omitted",
+			contentType: "application/json",
+			body:        `{"name":"ann"}`,
+		},
+		{
+			name:        "wrong content type",
+			contentType: "text/plain",
+			body:        `{"name":"ann"}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    CodeUnsupportedMediaType,
+		},
+		{
+			name:        "empty body",
+			contentType: "application/json",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeInvalidBody,
+		},
+		{
+			name:        "malformed json",
+			contentType: "application/json",
+			body:        `{"name":`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeInvalidBody,
+		},
+		{
+			name:        "trailing data",
+			contentType: "application/json",
+			body:        `{"name":"ann"} {"name":"bob"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeInvalidBody,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json",
+			body:        `{"name":"ann","admin":true}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperr.CodeValidation,
+			wantFields:  []string{"admin"},
+		},
+		{
+			name:        "wrong type",
+			contentType: "application/json",
+			body:        `{"name":"ann","age":"old"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperr.CodeValidation,
+			wantFields:  []string{"age"},
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        `{"name":"` + strings.Repeat("a", 64) + `"}`,
+			limit:       32,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    CodeBodyTooLarge,
+		},
+		{
+			name:        "all tag errors at once",
+			contentType: "application/json",
+			body:        `{"name":"toolong","email":"nope","role":"owner","age":12,"tags":["a","b","c"]}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperr.CodeValidation,
+			wantFields:  []string{"name", "email", "role", "age", "tags"},
+		},
+		{
+			name:        "method validation",
+			contentType: "application/json",
+			body:        `{"name":"ann","role":"admin","age":19}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperr.CodeValidation,
+			wantFields:  []string{"age"},
+		},
+		{
+			name:        "missing required field",
+			contentType: "application/json",
+			body:        `{"name":"  "}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperr.CodeValidation,
+			wantFields:  []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			limit := tt.limit
+			if limit == 0 {
+				limit = DefaultMaxBytes
+			}
+
+			_, err := DecodeLimit[testRequest](httptest.NewRecorder(), req, limit)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("DecodeLimit() error = %v", err)
+				}
+				return
+			}
+
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) {
+				t.Fatalf("DecodeLimit() error = %v, want *apperr.Error", err)
+			}
+			if appErr.Status != tt.wantStatus || appErr.Code != tt.wantCode {
+				t.Errorf("DecodeLimit() = %d %s, want %d %s", appErr.Status, appErr.Code, tt.wantStatus, tt.wantCode)
+			}
+			var fields []string
+			for _, f := range appErr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       any
+		wantErr string
+	}{
+		{name: "valid", v: testRequest{}},
+		{name: "pointer", v: &testRequest{}},
+		{name: "not a struct", v: "x"},
+		{name: "unknown rule", v: struct {
+			Name string `validate:"requird"`
+		}{}, wantErr: `unknown validation rule "requird"`},
+		{name: "bad argument", v: struct {
+			Name string `validate:"max=ten"`
+		}{}, wantErr: `invalid validation argument "ten"`},
+		{name: "embedded", v: struct {
+			Embedded
+		}{}, wantErr: `unknown validation rule "nope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRules(tt.v)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckRules() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckRules() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Embedded is exported, the fields of unexported embedded structs are skipped
+type Embedded struct {
+	Code string `validate:"nope"`
+}
+
+func TestValidateUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for unknown rule")
+		}
+	}()
+	Validate(struct {
+		Name string `validate:"requird"`
+	}{Name: "x"})
+}
@@ -0,0 +1,13 @@
+package request
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WriteJSON writes v as the JSON response body with status
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
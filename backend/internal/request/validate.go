@@ -0,0 +1,224 @@
+package request
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+)
+
+// Validate runs the `validate` struct tag rules on v and returns every failing field.
+// Rules are comma separated and checked in order, the first failing rule is reported:
+//
+//	required   non-zero, strings must not be blank
+//	email      a plain address like user@example.com
+//	min=N      minimum string length, slice length or number
+//	max=N      maximum string length, slice length or number
+//	oneof=a b  one of the space separated values
+//
+// Apart from required, rules are skipped for empty values so optional fields can be omitted.
+// Tags are parsed once per type, an unknown rule or a bad argument panics the first time the
+// type is seen. Routes documented with a request type are checked when they are registered.
+func Validate(v any) []apperr.FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	fields, err := rulesFor(rv.Type())
+	if err != nil {
+		// a typo in a tag is a programming error, fail loudly in tests
+		panic(err.Error())
+	}
+
+	var errs []apperr.FieldError
+	for _, f := range fields {
+		if fe, failed := checkField(f.name, rv.FieldByIndex(f.index), f.rules); failed {
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+// CheckRules parses the validate tags of v's type and reports the first bad one
+func CheckRules(v any) error {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	_, err := rulesFor(t)
+	return err
+}
+
+// rule is one entry of a validate tag
+type rule struct {
+	name string
+	arg  string
+	n    float64 // the bound of min and max
+}
+
+// fieldRules are the rules of one field, index reaches it through embedded structs
+type fieldRules struct {
+	index []int
+	name  string
+	rules []rule
+}
+
+// typeRules caches the parsed fields of every struct type seen, reflect.Type -> []fieldRules
+var typeRules sync.Map
+
+func rulesFor(t reflect.Type) ([]fieldRules, error) {
+	if cached, ok := typeRules.Load(t); ok {
+		return cached.([]fieldRules), nil
+	}
+	fields, err := parseRules(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	typeRules.Store(t, fields)
+	return fields, nil
+}
+
+func parseRules(t reflect.Type, index []int) ([]fieldRules, error) {
+	var fields []fieldRules
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		idx := append(slices.Clip(index), i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			embedded, err := parseRules(sf.Type, idx)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || tag == "" {
+			continue
+		}
+
+		f := fieldRules{index: idx, name: fieldName(sf)}
+		for _, entry := range strings.Split(tag, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			r := rule{name: name, arg: arg}
+			switch name {
+			case "required", "email", "oneof":
+			case "min", "max":
+				n, err := strconv.ParseFloat(arg, 64)
+				if err != nil {
+					return nil, fmt.Errorf("request: invalid validation argument %q of %s on %s.%s", arg, name, t, sf.Name)
+				}
+				r.n = n
+			default:
+				return nil, fmt.Errorf("request: unknown validation rule %q on %s.%s", name, t, sf.Name)
+			}
+			f.rules = append(f.rules, r)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// fieldName uses the json name so errors point at what the client sent
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func checkField(name string, fv reflect.Value, rules []rule) (apperr.FieldError, bool) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			break
+		}
+		fv = fv.Elem()
+	}
+	empty := isEmpty(fv)
+
+	for _, r := range rules {
+		if r.name != "required" && empty {
+			continue
+		}
+
+		switch r.name {
+		case "required":
+			if empty {
+				return apperr.FieldError{Field: name, Code: "required", Message: name + " cannot be empty"}, true
+			}
+		case "email":
+			if !isEmail(fv.String()) {
+				return apperr.FieldError{Field: name, Code: "invalid", Message: "invalid email address"}, true
+			}
+		case "min":
+			if n, ok := size(fv); ok && n < r.n {
+				return apperr.FieldError{Field: name, Code: "too_short", Message: fmt.Sprintf("%s must be at least %s%s", name, r.arg, unit(fv))}, true
+			}
+		case "max":
+			if n, ok := size(fv); ok && n > r.n {
+				return apperr.FieldError{Field: name, Code: "too_long", Message: fmt.Sprintf("%s must be at most %s%s", name, r.arg, unit(fv))}, true
+			}
+		case "oneof":
+			if !slices.Contains(strings.Fields(r.arg), fmt.Sprint(fv.Interface())) {
+				return apperr.FieldError{Field: name, Code: "invalid", Message: fmt.Sprintf("%s must be one of %s", name, strings.Join(strings.Fields(r.arg), ", "))}, true
+			}
+		}
+	}
+	return apperr.FieldError{}, false
+}
+
+func isEmpty(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(fv.String()) == ""
+	case reflect.Invalid:
+		return true
+	}
+	return fv.IsZero()
+}
+
+// isEmail accepts a single bare address, display names and lists are rejected
+func isEmail(s string) bool {
+	s = strings.TrimSpace(s)
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// size is the value min and max compare against: characters, elements or the number itself
+func size(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(strings.TrimSpace(fv.String()))), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	}
+	return 0, false
+}
+
+func unit(fv reflect.Value) string {
+	switch fv.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return " items"
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+)
+
+const problemContentType = apperr.ContentType
+
+//go:embed docs.html
+var docsHTML string
+
+var docsPage = template.Must(template.New("docs").Parse(docsHTML))
+
+// wildcard matches ServeMux path wildcards, {name} and {name...}
+var wildcard = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       DocumentInfo                    `json:"info"`
+	Servers    []Server                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type DocumentInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// sessions are the go-pkgz JWT, read from the cookie or the X-JWT header
+var securitySchemes = map[string]SecurityScheme{
+	"cookieAuth": {Type: "apiKey", In: "cookie", Name: "JWT", Description: "Session cookie set on login"},
+	"headerAuth": {Type: "apiKey", In: "header", Name: "X-JWT", Description: "Session token for clients without cookies"},
+}
+
+// OpenAPI builds the document for all routes that aren't hidden
+func (rt *Router) OpenAPI(serverURL string) *Document {
+	reg := newSchemaRegistry()
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    DocumentInfo{Title: rt.info.Title, Version: rt.info.Version, Description: rt.info.Description},
+		Paths:   map[string]map[string]Operation{},
+	}
+	if serverURL != "" {
+		doc.Servers = []Server{{URL: serverURL}}
+	}
+
+	problem := reg.schemaOf(apperr.Problem{})
+	for _, r := range rt.routes {
+		if r.hidden {
+			continue
+		}
+		path, params := openAPIPath(r.path)
+		op := Operation{
+			OperationID: operationID(r.method, r.path),
+			Summary:     r.summary,
+			Description: r.description,
+			Tags:        r.tags,
+			Parameters:  params,
+			Responses:   map[string]Response{},
+		}
+		for _, q := range r.query {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: q.name, In: "query", Description: q.description, Required: q.required,
+				Schema: &Schema{Type: "string"},
+			})
+		}
+		if r.request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{r.reqType: {Schema: reg.schemaOf(r.request)}},
+			}
+		}
+		for _, status := range slices.Sorted(maps.Keys(r.responses)) {
+			res := r.responses[status]
+			out := Response{Description: res.description}
+			switch {
+			case res.contentType == problemContentType:
+				out.Content = map[string]MediaType{problemContentType: {Schema: problem}}
+			case res.contentType != "":
+				out.Content = map[string]MediaType{res.contentType: {Schema: reg.schemaOf(res.body)}}
+			}
+			op.Responses[strconv.Itoa(status)] = out
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["default"] = Response{Description: "Response is not documented"}
+		}
+		if r.auth {
+			op.Security = []map[string][]string{{"cookieAuth": {}}, {"headerAuth": {}}}
+			if _, ok := r.responses[http.StatusUnauthorized]; !ok {
+				op.Responses["401"] = Response{Description: "Not logged in"}
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]Operation{}
+		}
+		doc.Paths[path][strings.ToLower(r.method)] = op
+	}
+
+	doc.Components = Components{Schemas: reg.components, SecuritySchemes: securitySchemes}
+	return doc
+}
+
+// OpenAPIHandler serves the document as JSON. It is built on the first request,
+// after every route has been registered.
+func (rt *Router) OpenAPIHandler(serverURL string) http.HandlerFunc {
+	var (
+		once sync.Once
+		body []byte
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			body, err = json.MarshalIndent(rt.OpenAPI(serverURL), "", "  ")
+		})
+		if err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// DocsHandler serves a self-contained page that renders the document at specURL
+func DocsHandler(specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Link", "<"+specURL+">; rel=\"service-desc\"")
+		// inline script and style carry the nonce of the security headers middleware
+		_ = docsPage.Execute(w, struct{ Nonce string }{middleware.CSPNonce(r.Context())})
+	}
+}
+
+// openAPIPath converts ServeMux wildcards to path parameters
+func openAPIPath(pattern string) (string, []Parameter) {
+	var params []Parameter
+	path := wildcard.ReplaceAllStringFunc(pattern, func(m string) string {
+		name := wildcard.FindStringSubmatch(m)[1]
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		return "{" + name + "}"
+	})
+	return path, params
+}
+
+// operationID derives a stable camelCase id like postAuthLocalSignup for client generators
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	upperNext := true
+	for _, c := range path {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			if upperNext && c >= 'a' && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			id += string(c)
+			upperNext = false
+		default:
+			upperNext = true
+		}
+	}
+	return id
+}
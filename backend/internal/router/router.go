@@ -0,0 +1,181 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/anish-chanda/go-app-starter/internal/request"
+)
+
+// Info describes the API in the generated document
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// Router registers handlers on a ServeMux and records what they accept and return,
+// so the OpenAPI document can't drift from the routes that are actually served.
+type Router struct {
+	mux      *http.ServeMux
+	info     Info
+	routes   []*Route
+	patterns []string
+}
+
+// New creates a router that registers on mux
+func New(mux *http.ServeMux, info Info) *Router {
+	return &Router{mux: mux, info: info}
+}
+
+// Handle registers h for method and path, path may use ServeMux wildcards like {id}
+func (rt *Router) Handle(method, path string, h http.Handler) *Route {
+	rt.register(method+" "+path, h)
+	return rt.Document(method, path)
+}
+
+// HandleFunc is Handle for a handler function
+func (rt *Router) HandleFunc(method, path string, h http.HandlerFunc) *Route {
+	return rt.Handle(method, path, h)
+}
+
+// Mount registers h for a ServeMux pattern without documenting anything, usually a prefix
+// like /auth/ with every path under it. Use Document to describe the routes it serves.
+func (rt *Router) Mount(pattern string, h http.Handler) {
+	rt.register(pattern, h)
+}
+
+// Patterns returns every pattern registered on the mux in registration order
+func (rt *Router) Patterns() []string {
+	return rt.patterns
+}
+
+func (rt *Router) register(pattern string, h http.Handler) {
+	rt.mux.Handle(pattern, h)
+	rt.patterns = append(rt.patterns, pattern)
+}
+
+// Document describes a route that is served by a mounted handler
+func (rt *Router) Document(method, path string) *Route {
+	r := &Route{method: strings.ToUpper(method), path: path, responses: map[int]response{}}
+	rt.routes = append(rt.routes, r)
+	return r
+}
+
+// Routes returns the documented routes in registration order
+func (rt *Router) Routes() []*Route {
+	return rt.routes
+}
+
+// Route collects the documentation of one operation, the setters return the route for chaining
+type Route struct {
+	method      string
+	path        string
+	summary     string
+	description string
+	tags        []string
+	auth        bool
+	hidden      bool
+	request     any
+	reqType     string
+	query       []param
+	responses   map[int]response
+}
+
+type param struct {
+	name        string
+	description string
+	required    bool
+}
+
+type response struct {
+	description string
+	contentType string
+	body        any
+}
+
+// Method returns the HTTP method of the route
+func (r *Route) Method() string { return r.method }
+
+// Path returns the path pattern of the route
+func (r *Route) Path() string { return r.path }
+
+// Summary sets the one line summary
+func (r *Route) Summary(s string) *Route {
+	r.summary = s
+	return r
+}
+
+// Description sets the long description, markdown is allowed
+func (r *Route) Description(s string) *Route {
+	r.description = s
+	return r
+}
+
+// Tags groups the route in the docs
+func (r *Route) Tags(tags ...string) *Route {
+	r.tags = append(r.tags, tags...)
+	return r
+}
+
+// Auth marks the route as requiring a session
+func (r *Route) Auth() *Route {
+	r.auth = true
+	return r
+}
+
+// Hidden leaves the route out of the document
+func (r *Route) Hidden() *Route {
+	r.hidden = true
+	return r
+}
+
+// Request sets the JSON request body, v is a zero value of the body type. Its validate
+// tags are checked here, so a bad one panics at startup rather than on a request.
+func (r *Route) Request(v any) *Route {
+	if err := request.CheckRules(v); err != nil {
+		panic(err)
+	}
+	r.request = v
+	r.reqType = "application/json"
+	return r
+}
+
+// Form sets a form encoded request body, v is a zero value of a struct describing the fields
+func (r *Route) Form(v any) *Route {
+	r.request = v
+	r.reqType = "application/x-www-form-urlencoded"
+	return r
+}
+
+// Query documents a query parameter
+func (r *Route) Query(name, description string, required bool) *Route {
+	r.query = append(r.query, param{name: name, description: description, required: required})
+	return r
+}
+
+// Response documents a JSON response, a nil body means the response has none
+func (r *Route) Response(status int, description string, body any) *Route {
+	ct := ""
+	if body != nil {
+		ct = "application/json"
+		if _, ok := body.(string); ok {
+			ct = "text/plain"
+		}
+	}
+	r.responses[status] = response{description: description, contentType: ct, body: body}
+	return r
+}
+
+// Redirect documents a redirect response
+func (r *Route) Redirect(status int, description string) *Route {
+	return r.Response(status, description, nil)
+}
+
+// Problems documents error responses rendered by apperr as problem details
+func (r *Route) Problems(statuses ...int) *Route {
+	for _, status := range statuses {
+		r.responses[status] = response{description: http.StatusText(status), contentType: problemContentType}
+	}
+	return r
+}
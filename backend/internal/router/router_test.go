@@ -0,0 +1,155 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type createItem struct {
+	Name  string   `json:"name" validate:"required,max=64"`
+	Email string   `json:"email,omitempty" validate:"email"`
+	Kind  string   `json:"kind,omitempty" validate:"oneof=a b"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type item struct {
+	ID      uuid.UUID  `json:"id"`
+	Name    string     `json:"name"`
+	Created time.Time  `json:"created_at"`
+	Parent  *item      `json:"parent,omitempty"`
+	Deleted *time.Time `json:"deleted_at"`
+	secret  string
+}
+
+func newTestRouter() (*Router, *http.ServeMux) {
+	mux := http.NewServeMux()
+	rt := New(mux, Info{Title: "Test", Version: "1"})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	rt.Handle("POST", "/items", ok).Summary("Create").Tags("items").Auth().
+		Request(createItem{}).
+		Response(http.StatusCreated, "Created", item{}).
+		Problems(http.StatusBadRequest)
+	rt.HandleFunc("GET", "/items/{id}", ok).Response(http.StatusOK, "Item", item{})
+	rt.HandleFunc("GET", "/files/{path...}", ok)
+	rt.HandleFunc("GET", "/internal", ok).Hidden()
+	rt.Mount("/mounted/", ok)
+	rt.Document("GET", "/mounted/thing").Response(http.StatusOK, "Text", "")
+	return rt, mux
+}
+
+func TestRoutesAreServed(t *testing.T) {
+	_, mux := newTestRouter()
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodPost, "/items"},
+		{http.MethodGet, "/items/42"},
+		{http.MethodGet, "/files/a/b"},
+		{http.MethodGet, "/internal"},
+		{http.MethodGet, "/mounted/anything"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, http.StatusNoContent)
+		}
+	}
+}
+
+func TestRequestChecksRules(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for the bad validate tag")
+		}
+	}()
+	rt, _ := newTestRouter()
+	rt.HandleFunc("POST", "/bad", func(http.ResponseWriter, *http.Request) {}).Request(struct {
+		Name string `json:"name" validate:"requird"`
+	}{})
+}
+
+func TestPatterns(t *testing.T) {
+	rt, _ := newTestRouter()
+	want := []string{"POST /items", "GET /items/{id}", "GET /files/{path...}", "GET /internal", "/mounted/"}
+	if got := rt.Patterns(); !slices.Equal(got, want) {
+		t.Errorf("Patterns = %v, want %v", got, want)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	rt, _ := newTestRouter()
+	doc := rt.OpenAPI("https://api.example.com")
+
+	if _, ok := doc.Paths["/internal"]; ok {
+		t.Error("hidden route is documented")
+	}
+	if _, ok := doc.Paths["/mounted/thing"]["get"]; !ok {
+		t.Error("documented mounted route is missing")
+	}
+	if doc.Servers[0].URL != "https://api.example.com" {
+		t.Errorf("servers = %v", doc.Servers)
+	}
+
+	create := doc.Paths["/items"]["post"]
+	if create.OperationID != "postItems" || create.Security == nil {
+		t.Errorf("create operation = %+v, want id postItems and security", create)
+	}
+	if _, ok := create.Responses["401"]; !ok {
+		t.Error("auth route is missing the 401 response")
+	}
+	if create.Responses["400"].Content["application/problem+json"].Schema.Ref != "#/components/schemas/Problem" {
+		t.Errorf("400 response = %+v, want problem schema", create.Responses["400"])
+	}
+
+	req := create.RequestBody.Content["application/json"].Schema
+	if req.Ref != "#/components/schemas/createItem" {
+		t.Fatalf("request schema = %+v", req)
+	}
+	body := doc.Components.Schemas["createItem"]
+	if !slices.Equal(body.Required, []string{"name"}) {
+		t.Errorf("required = %v, want [name]", body.Required)
+	}
+	if *body.Properties["name"].MaxLength != 64 || body.Properties["email"].Format != "email" ||
+		!slices.Equal(body.Properties["kind"].Enum, []string{"a", "b"}) || body.Properties["tags"].Items.Type != "string" {
+		t.Errorf("request properties = %+v", body.Properties)
+	}
+
+	it := doc.Components.Schemas["item"]
+	if it.Properties["id"].Format != "uuid" || it.Properties["created_at"].Format != "date-time" ||
+		it.Properties["parent"].Ref != "#/components/schemas/item" || !it.Properties["deleted_at"].Nullable {
+		t.Errorf("item properties = %+v", it.Properties)
+	}
+	if _, ok := it.Properties["secret"]; ok {
+		t.Error("unexported field is documented")
+	}
+
+	get := doc.Paths["/items/{id}"]["get"]
+	if len(get.Parameters) != 1 || get.Parameters[0].Name != "id" || get.Parameters[0].In != "path" {
+		t.Errorf("parameters = %+v, want path parameter id", get.Parameters)
+	}
+	if _, ok := doc.Paths["/files/{path}"]; !ok {
+		t.Error("rest wildcard was not converted")
+	}
+	if _, ok := doc.Paths["/mounted/thing"]["get"].Responses["200"].Content["text/plain"]; !ok {
+		t.Error("string response is not text/plain")
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	rt, _ := newTestRouter()
+	rec := httptest.NewRecorder()
+	rt.OpenAPIHandler("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	var doc map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", doc["openapi"])
+	}
+}
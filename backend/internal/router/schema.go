@@ -0,0 +1,218 @@
+package router
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object generated from Go types
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// schemaRegistry turns Go types into schemas, named structs become shared components
+type schemaRegistry struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// schemaOf returns the schema for the type of v, nil for a nil value
+func (s *schemaRegistry) schemaOf(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemaRegistry) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(textMarshalerType):
+		sc := &Schema{Type: "string"}
+		if strings.HasSuffix(t.PkgPath(), "uuid") {
+			sc.Format = "uuid"
+		}
+		return sc
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		sc := s.schema(t.Elem())
+		if sc.Ref == "" {
+			sc.Nullable = true
+		}
+		return sc
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	}
+	// interfaces and anything else accept any value
+	return &Schema{}
+}
+
+// component registers a named struct once and returns its component name
+func (s *schemaRegistry) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		// same type name in two packages, qualify the second one
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	s.names[t] = name
+	// reserve the name before recursing so self references terminate
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.structSchema(t)
+	return name
+}
+
+func (s *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	sc := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(sc, t)
+	return sc
+}
+
+func (s *schemaRegistry) addFields(sc *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// embedded structs without a json name are flattened like encoding/json does
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.addFields(sc, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := s.schema(f.Type)
+		required := applyRules(prop, f.Tag.Get("validate"))
+		if !required && !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = true
+		}
+		sc.Properties[name] = prop
+		if required {
+			sc.Required = append(sc.Required, name)
+		}
+	}
+}
+
+// applyRules copies request.Validate rules onto the schema and reports whether the field is required
+func applyRules(sc *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch rule {
+		case "required":
+			required = true
+			if sc.Type == "string" && sc.MinLength == nil {
+				sc.MinLength = intPtr(1)
+			}
+		case "email":
+			sc.Format = "email"
+		case "oneof":
+			sc.Enum = strings.Fields(arg)
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			setBound(sc, rule == "min", n)
+		}
+	}
+	return required
+}
+
+func setBound(sc *Schema, isMin bool, n float64) {
+	switch sc.Type {
+	case "string":
+		if isMin {
+			sc.MinLength = intPtr(int(n))
+		} else {
+			sc.MaxLength = intPtr(int(n))
+		}
+	case "array":
+		if isMin {
+			sc.MinItems = intPtr(int(n))
+		} else {
+			sc.MaxItems = intPtr(int(n))
+		}
+	case "integer", "number":
+		if isMin {
+			sc.Minimum = &n
+		} else {
+			sc.Maximum = &n
+		}
+	}
+}
+
+func intPtr(n int) *int { return &n }
@@ -0,0 +1,122 @@
+package signup
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"strings"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+//go:embed disposable_domains.txt
+var disposableList string
+
+var (
+	// ErrClosed is returned when signups are closed
+	ErrClosed = errors.New("signups are closed")
+	// ErrInviteRequired is returned in invite mode when no invite was presented
+	ErrInviteRequired = errors.New("an invite is required to sign up")
+	// ErrDomainNotAllowed is returned for domains outside the allowlist or on the denylist
+	ErrDomainNotAllowed = errors.New("email domain is not allowed")
+	// ErrDisposableEmail is returned for disposable email domains
+	ErrDisposableEmail = errors.New("disposable email addresses are not allowed")
+)
+
+// Policy decides who may create an account. The checks here only need the email,
+// invites live in the database and are checked by the caller when InviteRequired.
+type Policy struct {
+	mode       cfg.SignupMode
+	allowed    map[string]struct{}
+	denied     map[string]struct{}
+	disposable map[string]struct{}
+}
+
+// New creates the policy, domains are matched case-insensitively
+func New(conf cfg.SignupConfig) *Policy {
+	p := &Policy{
+		mode:    conf.Mode,
+		allowed: domainSet(conf.AllowedDomains),
+		denied:  domainSet(conf.DeniedDomains),
+	}
+	if p.mode == "" {
+		p.mode = cfg.SignupModeOpen
+	}
+	if conf.BlockDisposable {
+		p.disposable = parseDomainList(disposableList)
+	}
+	return p
+}
+
+// Mode returns the signup mode
+func (p *Policy) Mode() cfg.SignupMode {
+	return p.mode
+}
+
+// InviteRequired reports whether new accounts need an invite
+func (p *Policy) InviteRequired() bool {
+	return p.mode == cfg.SignupModeInvite
+}
+
+// CheckEmail reports whether a new account may be created for the normalized email
+func (p *Policy) CheckEmail(email string) error {
+	if p.mode == cfg.SignupModeClosed {
+		return ErrClosed
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrDomainNotAllowed
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	if len(p.allowed) > 0 && !matchDomain(p.allowed, domain) {
+		return ErrDomainNotAllowed
+	}
+	if matchDomain(p.denied, domain) {
+		return ErrDomainNotAllowed
+	}
+	if matchDomain(p.disposable, domain) {
+		return ErrDisposableEmail
+	}
+	return nil
+}
+
+// matchDomain reports whether domain or one of its parent domains is in set
+func matchDomain(set map[string]struct{}, domain string) bool {
+	for domain != "" {
+		if _, ok := set[domain]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return false
+		}
+		domain = parent
+	}
+	return false
+}
+
+func domainSet(domains []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		if d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	return set
+}
+
+// parseDomainList reads one domain per line, skipping blank lines and # comments
+func parseDomainList(list string) map[string]struct{} {
+	var domains []string
+	sc := bufio.NewScanner(strings.NewReader(list))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domainSet(domains)
+}
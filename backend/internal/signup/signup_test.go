@@ -0,0 +1,103 @@
+package signup
+
+import (
+	"errors"
+	"testing"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+)
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    cfg.SignupConfig
+		email   string
+		wantErr error
+	}{
+		{
+			name:  "open",
+			conf:  cfg.SignupConfig{Mode: cfg.SignupModeOpen},
+			email: "user@example.com",
+		},
+		{
+			name:  "default mode is open",
+			email: "user@example.com",
+		},
+		{
+			name:    "closed",
+			conf:    cfg.SignupConfig{Mode: cfg.SignupModeClosed},
+			email:   "user@example.com",
+			wantErr: ErrClosed,
+		},
+		{
+			name:  "invite mode still checks domains only",
+			conf:  cfg.SignupConfig{Mode: cfg.SignupModeInvite},
+			email: "user@example.com",
+		},
+		{
+			name:  "allowlisted domain",
+			conf:  cfg.SignupConfig{AllowedDomains: []string{"Example.com"}},
+			email: "user@example.com",
+		},
+		{
+			name:  "subdomain of allowlisted domain",
+			conf:  cfg.SignupConfig{AllowedDomains: []string{"example.com"}},
+			email: "user@eu.example.com",
+		},
+		{
+			name:    "domain outside allowlist",
+			conf:    cfg.SignupConfig{AllowedDomains: []string{"example.com"}},
+			email:   "user@other.com",
+			wantErr: ErrDomainNotAllowed,
+		},
+		{
+			name:    "suffix is not a subdomain",
+			conf:    cfg.SignupConfig{AllowedDomains: []string{"example.com"}},
+			email:   "user@badexample.com",
+			wantErr: ErrDomainNotAllowed,
+		},
+		{
+			name:    "denylisted domain",
+			conf:    cfg.SignupConfig{DeniedDomains: []string{"competitor.com"}},
+			email:   "spy@mail.competitor.com",
+			wantErr: ErrDomainNotAllowed,
+		},
+		{
+			name:    "denylist wins over allowlist",
+			conf:    cfg.SignupConfig{AllowedDomains: []string{"example.com"}, DeniedDomains: []string{"contractors.example.com"}},
+			email:   "user@contractors.example.com",
+			wantErr: ErrDomainNotAllowed,
+		},
+		{
+			name:    "disposable domain",
+			conf:    cfg.SignupConfig{BlockDisposable: true},
+			email:   "user@mailinator.com",
+			wantErr: ErrDisposableEmail,
+		},
+		{
+			name:  "disposable domain allowed when blocking is off",
+			email: "user@mailinator.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New(tt.conf).CheckEmail(tt.email)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckEmail(%q) error = %v, want %v", tt.email, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDisposableList(t *testing.T) {
+	domains := parseDomainList(disposableList)
+	if len(domains) < 100 {
+		t.Errorf("disposable list has %d domains, expected the bundled list", len(domains))
+	}
+	for d := range domains {
+		if d[0] == '#' {
+			t.Errorf("comment parsed as domain: %q", d)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package sso
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcClient is a discovered OIDC provider, cached until the connection changes
+type oidcClient struct {
+	updatedAt int64
+	oauth     oauth2.Config
+	verifier  *oidc.IDTokenVerifier
+}
+
+// oidcIDClaims are the ID token claims used for provisioning
+type oidcIDClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"` // Azure AD may omit email
+}
+
+// oidcClient returns the client for the connection, running discovery on first use
+func (s *Service) oidcClient(ctx context.Context, conn *models.SSOConnection) (*oidcClient, error) {
+	s.mu.Lock()
+	c, ok := s.clients[conn.Id]
+	s.mu.Unlock()
+	if ok && c.updatedAt == conn.UpdatedAt {
+		return c, nil
+	}
+
+	// accept the discovery URL as well as the bare issuer
+	issuer := strings.TrimSuffix(strings.TrimSuffix(conn.OIDCIssuer, "/.well-known/openid-configuration"), "/")
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	c = &oidcClient{
+		updatedAt: conn.UpdatedAt,
+		oauth: oauth2.Config{
+			ClientID:     conn.OIDCClientId,
+			ClientSecret: conn.OIDCClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  s.BaseURL + "/auth/sso/oidc/callback",
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: conn.OIDCClientId}),
+	}
+
+	s.mu.Lock()
+	s.clients[conn.Id] = c
+	s.mu.Unlock()
+	return c, nil
+}
+
+// oidcAuthURL builds the authorization request, with nonce and PKCE recorded in pending
+func (s *Service) oidcAuthURL(ctx context.Context, conn *models.SSOConnection, state, email string,
+	pending *models.SSOLoginState) (string, error) {
+	c, err := s.oidcClient(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := authutil.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	pending.Nonce = nonce
+	pending.CodeVerifier = oauth2.GenerateVerifier()
+
+	return c.oauth.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(pending.CodeVerifier),
+		oauth2.SetAuthURLParam("login_hint", email),
+	), nil
+}
+
+// OIDCCallback serves GET /auth/sso/oidc/callback
+func (s *Service) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	pending, conn, err := s.consumeState(w, r, q.Get("state"))
+	if err != nil {
+		fail(w, r, err, "invalid oidc sso state")
+		return
+	}
+	if conn.Protocol != models.SSOProtocolOIDC {
+		fail(w, r, fmt.Errorf("connection %s is not oidc", conn.Id), "oidc callback for a saml connection")
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		fail(w, r, fmt.Errorf("%s: %s", e, q.Get("error_description")), "identity provider returned an error")
+		return
+	}
+
+	c, err := s.oidcClient(ctx, conn)
+	if err != nil {
+		fail(w, r, err, "oidc provider unavailable")
+		return
+	}
+
+	tok, err := c.oauth.Exchange(ctx, q.Get("code"), oauth2.VerifierOption(pending.CodeVerifier))
+	if err != nil {
+		fail(w, r, err, "oidc code exchange failed")
+		return
+	}
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok {
+		fail(w, r, fmt.Errorf("token response has no id_token"), "oidc code exchange failed")
+		return
+	}
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		fail(w, r, err, "invalid oidc id token")
+		return
+	}
+	if idToken.Nonce != pending.Nonce {
+		fail(w, r, fmt.Errorf("nonce mismatch"), "invalid oidc id token")
+		return
+	}
+
+	var claims oidcIDClaims
+	if err := idToken.Claims(&claims); err != nil {
+		fail(w, r, err, "invalid oidc id token claims")
+		return
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		fail(w, r, fmt.Errorf("email %q is not verified", claims.Email), "identity provider asserted an unverified email")
+		return
+	}
+
+	email := claims.Email
+	if email == "" {
+		if addr, err := mail.ParseAddress(claims.PreferredUsername); err == nil {
+			email = addr.Address
+		}
+	}
+
+	s.complete(w, r, conn, pending, identity{Email: email, Name: claims.Name})
+}
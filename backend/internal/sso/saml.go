@@ -0,0 +1,159 @@
+package sso
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// attribute names IdPs commonly use, matched against Name and FriendlyName
+var (
+	samlEmailAttrs = []string{
+		"email", "mail", "emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	samlNameAttrs = []string{
+		"name", "displayname", "cn",
+		"urn:oid:2.5.4.3",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+	}
+)
+
+// serviceProvider returns the SAML service provider for the connection's IdP
+func (s *Service) serviceProvider(conn *models.SSOConnection) (*saml.ServiceProvider, error) {
+	idp, err := samlsp.ParseMetadata([]byte(conn.SAMLIDPMetadata))
+	if err != nil {
+		return nil, fmt.Errorf("saml idp metadata: %w", err)
+	}
+	sp := s.metadataProvider()
+	sp.IDPMetadata = idp
+	return sp, nil
+}
+
+// metadataProvider is the service provider without an IdP, shared by all connections
+func (s *Service) metadataProvider() *saml.ServiceProvider {
+	metadataURL, _ := url.Parse(s.BaseURL + "/auth/sso/saml/metadata")
+	acsURL, _ := url.Parse(s.BaseURL + "/auth/sso/saml/acs")
+	return &saml.ServiceProvider{
+		EntityID:    metadataURL.String(),
+		Key:         s.spKey,
+		Certificate: s.spCert,
+		MetadataURL: *metadataURL,
+		AcsURL:      *acsURL,
+	}
+}
+
+// samlAuthURL builds a redirect binding AuthnRequest, its ID is recorded in pending
+func (s *Service) samlAuthURL(conn *models.SSOConnection, state string, pending *models.SSOLoginState) (string, error) {
+	sp, err := s.serviceProvider(conn)
+	if err != nil {
+		return "", err
+	}
+
+	ssoURL := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if ssoURL == "" {
+		return "", fmt.Errorf("saml idp has no HTTP-Redirect SSO endpoint")
+	}
+	req, err := sp.MakeAuthenticationRequest(ssoURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+	pending.RequestId = req.ID
+
+	u, err := req.Redirect(state, sp)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// SAMLACS serves POST /auth/sso/saml/acs, only responses to our own requests are accepted
+func (s *Service) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	pending, conn, err := s.consumeState(w, r, r.PostForm.Get("RelayState"))
+	if err != nil {
+		fail(w, r, err, "invalid saml sso state")
+		return
+	}
+	if conn.Protocol != models.SSOProtocolSAML {
+		fail(w, r, fmt.Errorf("connection %s is not saml", conn.Id), "saml response for an oidc connection")
+		return
+	}
+
+	sp, err := s.serviceProvider(conn)
+	if err != nil {
+		fail(w, r, err, "invalid saml idp metadata")
+		return
+	}
+	assertion, err := sp.ParseResponse(r, []string{pending.RequestId})
+	if err != nil {
+		// crewjam hides the reason behind a generic error, log the private one
+		if ie, ok := err.(*saml.InvalidResponseError); ok {
+			err = ie.PrivateErr
+		}
+		fail(w, r, err, "invalid saml response")
+		return
+	}
+
+	s.complete(w, r, conn, pending, samlIdentity(assertion))
+}
+
+// SAMLMetadata serves GET /auth/sso/saml/metadata, the document to register with IdPs
+func (s *Service) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	buf, err := xml.MarshalIndent(s.metadataProvider().Metadata(), "", "  ")
+	if err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("failed to render saml metadata")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(buf)
+}
+
+// samlIdentity reads the email and name attributes, falling back to an email NameID
+func samlIdentity(assertion *saml.Assertion) identity {
+	var id identity
+	for _, stmt := range assertion.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			if len(attr.Values) == 0 {
+				continue
+			}
+			value := strings.TrimSpace(attr.Values[0].Value)
+			if id.Email == "" && matchesAttr(attr, samlEmailAttrs) {
+				id.Email = value
+			}
+			if id.Name == "" && matchesAttr(attr, samlNameAttrs) {
+				id.Name = value
+			}
+		}
+	}
+
+	if id.Email == "" && assertion.Subject != nil && assertion.Subject.NameID != nil {
+		if addr, err := mail.ParseAddress(assertion.Subject.NameID.Value); err == nil {
+			id.Email = addr.Address
+		}
+	}
+	return id
+}
+
+func matchesAttr(attr saml.Attribute, names []string) bool {
+	for _, n := range names {
+		if strings.EqualFold(attr.Name, n) || strings.EqualFold(attr.FriendlyName, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,328 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/authutil"
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	stateCookieName = "sso_state"
+	stateTTL        = 10 * time.Minute
+)
+
+// Store is the subset of the database used by sso, implemented by *db.PostgresDB
+type Store interface {
+	GetSSOConnection(ctx context.Context, id uuid.UUID) (*models.SSOConnection, error)
+	GetSSOConnectionByDomain(ctx context.Context, domain string) (*models.SSOConnection, error)
+	CreateSSOLoginState(ctx context.Context, state models.SSOLoginState) error
+	ConsumeSSOLoginState(ctx context.Context, stateHash string) (*models.SSOLoginState, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateUser(ctx context.Context, user models.User) (*models.User, error)
+	SetUserOrganization(ctx context.Context, userID, orgID uuid.UUID) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+}
+
+// Service logs users in through the OIDC or SAML identity provider of their organization.
+// The email domain selects the organization, users are provisioned on their first login.
+//
+//	GET  /auth/sso/login?email=...   redirects to the organization's IdP
+//	GET  /auth/sso/oidc/callback     OIDC redirect URI
+//	POST /auth/sso/saml/acs          SAML assertion consumer service
+//	GET  /auth/sso/saml/metadata     SAML service provider metadata
+type Service struct {
+	Store    Store
+	Sessions *tokens.Service
+	BaseURL  string // public URL, the callback and ACS URLs are built from it
+
+	conf   cfg.SSOConfig
+	spKey  crypto.Signer
+	spCert *x509.Certificate
+
+	mu      sync.Mutex
+	clients map[uuid.UUID]*oidcClient // discovered OIDC providers by connection
+}
+
+// New creates the sso service, loading the optional SAML service provider key pair
+func New(conf cfg.SSOConfig, baseURL string, store Store, sessions *tokens.Service) (*Service, error) {
+	s := &Service{
+		Store:    store,
+		Sessions: sessions,
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		conf:     conf,
+		clients:  map[uuid.UUID]*oidcClient{},
+	}
+
+	if conf.SAMLCertPath != "" || conf.SAMLKeyPath != "" {
+		pair, err := tls.LoadX509KeyPair(conf.SAMLCertPath, conf.SAMLKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("saml sp key pair: %w", err)
+		}
+		signer, ok := pair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("saml sp key: unsupported key type %T", pair.PrivateKey)
+		}
+		s.spKey, s.spCert = signer, pair.Leaf
+	}
+
+	return s, nil
+}
+
+// identity is what the IdP asserted about the user
+type identity struct {
+	Email string
+	Name  string
+}
+
+// Login serves GET /auth/sso/login, sending the browser to the IdP for the email's domain
+func (s *Service) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	email, err := authutil.NormalizeEmail(r.URL.Query().Get("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := s.Store.GetSSOConnectionByDomain(ctx, emailDomain(email))
+	if err != nil {
+		if errors.Is(err, db.ErrSSOConnectionNotFound) {
+			http.Error(w, "single sign-on is not configured for this email domain", http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Msg("failed to look up sso connection")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	state, err := authutil.RandomToken()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate sso state")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	pending := models.SSOLoginState{
+		StateHash:    authutil.HashToken(state),
+		ConnectionId: conn.Id,
+		Audience:     r.URL.Query().Get("aud"),
+		ExpiresAt:    time.Now().Add(stateTTL),
+	}
+
+	var target string
+	switch conn.Protocol {
+	case models.SSOProtocolOIDC:
+		target, err = s.oidcAuthURL(ctx, conn, state, email, &pending)
+	case models.SSOProtocolSAML:
+		target, err = s.samlAuthURL(conn, state, &pending)
+	default:
+		err = fmt.Errorf("unsupported protocol %q", conn.Protocol)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("connection_id", conn.Id.String()).Msg("failed to build sso request")
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if err := s.Store.CreateSSOLoginState(ctx, pending); err != nil {
+		log.Error().Err(err).Msg("failed to store sso state")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.setStateCookie(w, state, int(stateTTL.Seconds()))
+	log.Info().Str("connection_id", conn.Id.String()).Str("protocol", string(conn.Protocol)).Msg("sso login started")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// consumeState checks the state returned by the IdP against the cookie of the browser
+// that started the login, so a response can't be replayed into another browser
+func (s *Service) consumeState(w http.ResponseWriter, r *http.Request, state string) (*models.SSOLoginState, *models.SSOConnection, error) {
+	c, err := r.Cookie(stateCookieName)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		return nil, nil, db.ErrSSOStateInvalid
+	}
+	s.setStateCookie(w, "", -1)
+
+	pending, err := s.Store.ConsumeSSOLoginState(r.Context(), authutil.HashToken(state))
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := s.Store.GetSSOConnection(r.Context(), pending.ConnectionId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, conn, nil
+}
+
+// setStateCookie binds the pending login to the browser. SAML responses are posted
+// cross-site by the IdP, so on https the cookie has to be SameSite=None.
+func (s *Service) setStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	secure := strings.HasPrefix(s.BaseURL, "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    value,
+		Path:     "/auth/sso",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
+// complete provisions the user asserted by the IdP and starts a regular session
+func (s *Service) complete(w http.ResponseWriter, r *http.Request, conn *models.SSOConnection,
+	pending *models.SSOLoginState, id identity) {
+	ctx := r.Context()
+	log := logger.Ctx(ctx)
+
+	user, err := s.provision(ctx, conn, id)
+	if err != nil {
+		var denied *deniedError
+		if errors.As(err, &denied) {
+			log.Warn().Str("connection_id", conn.Id.String()).Str("email", id.Email).Msg(denied.reason)
+			http.Error(w, "this account can't sign in with this identity provider", http.StatusForbidden)
+			return
+		}
+		log.Error().Err(err).Str("email", id.Email).Msg("failed to provision sso user")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cid, err := authutil.RandomToken()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate token id")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// ClaimsUpdater enriches these claims with uid and provider when the token is made
+	claims := token.Claims{
+		User: &token.User{
+			Name:  user.Name,
+			Email: user.Email,
+			ID:    string(models.AuthProviderSSO) + "_" + token.HashID(sha1.New(), user.Id.String()),
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       cid,
+			Issuer:   s.Sessions.Issuer,
+			Audience: []string{pending.Audience},
+		},
+		AuthProvider: &token.AuthProvider{Name: string(models.AuthProviderSSO)},
+	}
+	if _, err := s.Sessions.Set(w, claims); err != nil {
+		log.Error().Err(err).Msg("failed to set token")
+		http.Error(w, "failed to set token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("user_id", user.Id.String()).Str("organization_id", conn.OrganizationId.String()).Msg("user logged in with sso")
+
+	if s.conf.RedirectURL != "" {
+		http.Redirect(w, r, s.conf.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	request.WriteJSON(w, http.StatusOK, claims.User)
+}
+
+// deniedError is a login refused because of the asserted identity, not a server failure
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string { return e.reason }
+
+// provision finds or just-in-time creates the user for the asserted identity
+func (s *Service) provision(ctx context.Context, conn *models.SSOConnection, id identity) (*models.User, error) {
+	email, err := authutil.NormalizeEmail(id.Email)
+	if err != nil {
+		return nil, &deniedError{"identity provider asserted an invalid email"}
+	}
+
+	// an IdP may only sign in addresses of the domains routed to its organization,
+	// otherwise any tenant could take over accounts of other domains
+	owner, err := s.Store.GetSSOConnectionByDomain(ctx, emailDomain(email))
+	if err != nil && !errors.Is(err, db.ErrSSOConnectionNotFound) {
+		return nil, err
+	}
+	if owner == nil || owner.OrganizationId != conn.OrganizationId {
+		return nil, &deniedError{"identity provider asserted an email outside its domains"}
+	}
+
+	// the organization's admins decide who has an account at their IdP,
+	// so SIGNUP_MODE and the domain lists don't apply to sso provisioning
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if errors.Is(err, db.ErrUserNotFound) {
+		name := strings.TrimSpace(id.Name)
+		if name == "" {
+			name = strings.SplitN(email, "@", 2)[0]
+		}
+		logger.Ctx(ctx).Info().Str("email", email).Str("organization_id", conn.OrganizationId.String()).
+			Msg("creating user on first sso login")
+		return s.Store.CreateUser(ctx, models.User{
+			Name:           name,
+			Email:          email,
+			EmailVerified:  true,
+			AuthProvider:   models.AuthProviderSSO,
+			OrganizationId: &conn.OrganizationId,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.OrganizationId != nil && *user.OrganizationId != conn.OrganizationId {
+		return nil, &deniedError{"user belongs to another organization"}
+	}
+	if user.OrganizationId == nil {
+		if err := s.Store.SetUserOrganization(ctx, user.Id, conn.OrganizationId); err != nil {
+			return nil, err
+		}
+		user.OrganizationId = &conn.OrganizationId
+	}
+	if !user.EmailVerified {
+		if err := s.Store.MarkEmailVerified(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
+
+// fail reports a failed IdP response without leaking details to the browser
+func fail(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, db.ErrSSOStateInvalid) || errors.Is(err, db.ErrSSOConnectionNotFound) {
+		http.Error(w, "sso login is invalid or expired", http.StatusForbidden)
+		return
+	}
+	logger.Ctx(r.Context()).Warn().Err(err).Msg(msg)
+	http.Error(w, "sso login failed", http.StatusUnauthorized)
+}
+
+func emailDomain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
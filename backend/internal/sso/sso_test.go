@@ -0,0 +1,530 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/db"
+	"github.com/anish-chanda/go-app-starter/internal/models"
+	"github.com/anish-chanda/go-app-starter/internal/request"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu      sync.Mutex
+	conns   map[uuid.UUID]*models.SSOConnection
+	domains map[string]uuid.UUID // domain -> organization
+	states  map[string]*models.SSOLoginState
+	users   map[string]*models.User
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		conns:   map[uuid.UUID]*models.SSOConnection{},
+		domains: map[string]uuid.UUID{},
+		states:  map[string]*models.SSOLoginState{},
+		users:   map[string]*models.User{},
+	}
+}
+
+func (m *memStore) addConnection(conn models.SSOConnection, domains ...string) *models.SSOConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conn.Id, conn.OrganizationId, conn.Enabled = uuid.New(), uuid.New(), true
+	m.conns[conn.Id] = &conn
+	for _, d := range domains {
+		m.domains[d] = conn.OrganizationId
+	}
+	return &conn
+}
+
+func (m *memStore) GetSSOConnection(_ context.Context, id uuid.UUID) (*models.SSOConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.conns[id]; ok {
+		return c, nil
+	}
+	return nil, db.ErrSSOConnectionNotFound
+}
+
+func (m *memStore) GetSSOConnectionByDomain(_ context.Context, domain string) (*models.SSOConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.conns {
+		if org, ok := m.domains[domain]; ok && c.OrganizationId == org {
+			return c, nil
+		}
+	}
+	return nil, db.ErrSSOConnectionNotFound
+}
+
+func (m *memStore) CreateSSOLoginState(_ context.Context, state models.SSOLoginState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.StateHash] = &state
+	return nil
+}
+
+func (m *memStore) ConsumeSSOLoginState(_ context.Context, stateHash string) (*models.SSOLoginState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.states[stateHash]
+	if !ok || s.ExpiresAt.Before(time.Now()) {
+		return nil, db.ErrSSOStateInvalid
+	}
+	delete(m.states, stateHash)
+	return s, nil
+}
+
+func (m *memStore) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[email]; ok {
+		cp := *u
+		return &cp, nil
+	}
+	return nil, db.ErrUserNotFound
+}
+
+func (m *memStore) CreateUser(_ context.Context, user models.User) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.Id = uuid.New()
+	m.users[user.Email] = &user
+	cp := user
+	return &cp, nil
+}
+
+func (m *memStore) SetUserOrganization(_ context.Context, userID, orgID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Id == userID {
+			u.OrganizationId = &orgID
+		}
+	}
+	return nil
+}
+
+func (m *memStore) MarkEmailVerified(_ context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Id == id {
+			u.EmailVerified = true
+		}
+	}
+	return nil
+}
+
+func newTestService(t *testing.T, store Store) *Service {
+	t.Helper()
+	hmacKey := tokens.NewHMACKey("secret")
+	ks, err := tokens.NewKeySet(hmacKey.ID, hmacKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	sessions := tokens.NewService(token.NewService(token.Opts{Issuer: "app", TokenDuration: time.Hour}), ks)
+
+	s, err := New(cfg.SSOConfig{Enabled: true}, "http://app.example.com", store, sessions)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+// startLogin calls Login and returns the IdP URL and the state cookie
+func startLogin(t *testing.T, s *Service, email string) (*url.URL, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/sso/login?email="+url.QueryEscape(email), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login() status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location: %v", err)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == stateCookieName {
+			return loc, c
+		}
+	}
+	t.Fatalf("Login() did not set the %s cookie", stateCookieName)
+	return nil, nil
+}
+
+// sessionCookie returns the JWT cookie set after a successful login
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "JWT" && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+// mockOIDCIdP is a minimal OpenID provider issuing ID tokens for a fixed email
+type mockOIDCIdP struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	email string
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> authorization request
+}
+
+func newMockOIDCIdP(t *testing.T, email string) *mockOIDCIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	idp := &mockOIDCIdP{key: key, email: email, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		request.WriteJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		request.WriteJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "idp-1", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	// the user is always logged in at the IdP
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		code := uuid.NewString()
+		idp.mu.Lock()
+		idp.codes[code] = r.URL.Query()
+		idp.mu.Unlock()
+		http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(r.URL.Query().Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		idp.mu.Lock()
+		req, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		clientID, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || clientID != "app" || secret != "app-secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != req.Get("code_challenge") {
+			request.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": idp.URL, "sub": "idp-user-1", "aud": "app",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+			"nonce": req.Get("nonce"), "email": idp.email, "email_verified": true, "name": "Alice Example",
+		})
+		tkn.Header["kid"] = "idp-1"
+		idToken, err := tkn.SignedString(key)
+		if err != nil {
+			t.Errorf("SignedString() error = %v", err)
+		}
+		request.WriteJSON(w, http.StatusOK, map[string]any{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 60, "id_token": idToken,
+		})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// oidcLogin runs the browser side of the OIDC flow and returns the callback response
+// and a func sending the same callback again
+func oidcLogin(t *testing.T, s *Service, email string) (*httptest.ResponseRecorder, func() *httptest.ResponseRecorder) {
+	t.Helper()
+	authURL, stateCookie := startLogin(t, s, email)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL.String())
+	if err != nil {
+		t.Fatalf("GET authorize error = %v", err)
+	}
+	_ = resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Path != "/auth/sso/oidc/callback" {
+		t.Fatalf("IdP redirected to %q, want the oidc callback", resp.Header.Get("Location"))
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		req.AddCookie(stateCookie)
+		rec := httptest.NewRecorder()
+		s.OIDCCallback(rec, req)
+		return rec
+	}
+	return send(), send
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockOIDCIdP(t, "alice@acme.com")
+	store := newMemStore()
+	conn := store.addConnection(models.SSOConnection{
+		Protocol:         models.SSOProtocolOIDC,
+		OIDCIssuer:       idp.URL + "/.well-known/openid-configuration",
+		OIDCClientId:     "app",
+		OIDCClientSecret: "app-secret",
+	}, "acme.com")
+	s := newTestService(t, store)
+
+	rec, replay := oidcLogin(t, s, "alice@acme.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("OIDCCallback() status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if sessionCookie(rec) == nil {
+		t.Errorf("OIDCCallback() did not set a session cookie")
+	}
+
+	user, err := store.GetUserByEmail(context.Background(), "alice@acme.com")
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.Name != "Alice Example" || !user.EmailVerified || user.AuthProvider != models.AuthProviderSSO ||
+		user.OrganizationId == nil || *user.OrganizationId != conn.OrganizationId {
+		t.Errorf("provisioned user = %+v, want verified sso user of the organization", user)
+	}
+
+	// the state is single-use
+	if rec := replay(); rec.Code != http.StatusForbidden {
+		t.Errorf("replayed callback status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestOIDCLoginRejectsForeignDomain(t *testing.T) {
+	// the acme IdP asserts an address of a domain it does not own
+	idp := newMockOIDCIdP(t, "mallory@other.com")
+	store := newMemStore()
+	store.addConnection(models.SSOConnection{
+		Protocol:         models.SSOProtocolOIDC,
+		OIDCIssuer:       idp.URL,
+		OIDCClientId:     "app",
+		OIDCClientSecret: "app-secret",
+	}, "acme.com")
+	s := newTestService(t, store)
+
+	rec, _ := oidcLogin(t, s, "alice@acme.com")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("OIDCCallback() status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if _, err := store.GetUserByEmail(context.Background(), "mallory@other.com"); err == nil {
+		t.Errorf("user of a foreign domain was provisioned")
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	idp := newMockOIDCIdP(t, "alice@acme.com")
+	store := newMemStore()
+	store.addConnection(models.SSOConnection{
+		Protocol: models.SSOProtocolOIDC, OIDCIssuer: idp.URL, OIDCClientId: "app", OIDCClientSecret: "app-secret",
+	}, "acme.com")
+	s := newTestService(t, store)
+
+	authURL, _ := startLogin(t, s, "alice@acme.com")
+	req := httptest.NewRequest(http.MethodGet, "/auth/sso/oidc/callback?code=x&state="+authURL.Query().Get("state"), nil)
+	rec := httptest.NewRecorder()
+	s.OIDCCallback(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("OIDCCallback() status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestLoginUnknownDomain(t *testing.T) {
+	s := newTestService(t, newMemStore())
+
+	rec := httptest.NewRecorder()
+	s.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/sso/login?email=bob@example.com", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Login() status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// samlSessions always returns the same logged-in IdP user
+type samlSessions struct{ email string }
+
+func (p samlSessions) GetSession(_ http.ResponseWriter, _ *http.Request, _ *saml.IdpAuthnRequest) *saml.Session {
+	return &saml.Session{
+		ID:             "session-1",
+		CreateTime:     time.Now(),
+		ExpireTime:     time.Now().Add(time.Hour),
+		NameID:         p.email,
+		UserEmail:      p.email,
+		UserCommonName: "Bob Example",
+	}
+}
+
+// samlServiceProviders knows only our service provider
+type samlServiceProviders struct{ sp *saml.EntityDescriptor }
+
+func (p samlServiceProviders) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return p.sp, nil
+}
+
+// newMockSAMLIdP starts a crewjam IdP trusting the service's SP metadata and returns its metadata XML
+func newMockSAMLIdP(t *testing.T, s *Service, email string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mock idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	idp := &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		SessionProvider:         samlSessions{email: email},
+		ServiceProviderProvider: samlServiceProviders{sp: s.metadataProvider().Metadata()},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(idp.ServeSSO))
+	t.Cleanup(srv.Close)
+
+	base, _ := url.Parse(srv.URL)
+	idp.MetadataURL = *base.JoinPath("metadata")
+	idp.SSOURL = *base.JoinPath("sso")
+
+	buf, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatalf("Marshal(idp metadata) error = %v", err)
+	}
+	return string(buf)
+}
+
+var formInput = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+func TestSAMLLogin(t *testing.T) {
+	store := newMemStore()
+	s := newTestService(t, store)
+	conn := store.addConnection(models.SSOConnection{
+		Protocol:        models.SSOProtocolSAML,
+		SAMLIDPMetadata: newMockSAMLIdP(t, s, "bob@acme.com"),
+	}, "acme.com")
+
+	authURL, stateCookie := startLogin(t, s, "bob@acme.com")
+
+	// the IdP answers with an auto-submitting form posting to the ACS
+	resp, err := http.Get(authURL.String())
+	if err != nil {
+		t.Fatalf("GET idp sso error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read idp response: %v", err)
+	}
+	form := url.Values{}
+	for _, m := range formInput.FindAllStringSubmatch(string(body), -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	if form.Get("SAMLResponse") == "" {
+		t.Fatalf("IdP response has no SAMLResponse (status %d): %s", resp.StatusCode, body)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/sso/saml/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(stateCookie)
+	rec := httptest.NewRecorder()
+	s.SAMLACS(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SAMLACS() status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var u token.User
+	if err := json.NewDecoder(rec.Body).Decode(&u); err != nil || u.Email != "bob@acme.com" {
+		t.Errorf("SAMLACS() user = %+v (%v), want bob@acme.com", u, err)
+	}
+	if sessionCookie(rec) == nil {
+		t.Errorf("SAMLACS() did not set a session cookie")
+	}
+
+	user, err := store.GetUserByEmail(context.Background(), "bob@acme.com")
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.Name != "Bob Example" || *user.OrganizationId != conn.OrganizationId {
+		t.Errorf("provisioned user = %+v, want Bob Example of the organization", user)
+	}
+}
+
+func TestSAMLIdentity(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion saml.Assertion
+		want      identity
+	}{
+		{
+			name: "azure ad claims",
+			assertion: saml.Assertion{AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+				{Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", Values: []saml.AttributeValue{{Value: "a@acme.com"}}},
+				{Name: "http://schemas.microsoft.com/identity/claims/displayname", Values: []saml.AttributeValue{{Value: "A"}}},
+			}}}},
+			want: identity{Email: "a@acme.com", Name: "A"},
+		},
+		{
+			name:      "email name id",
+			assertion: saml.Assertion{Subject: &saml.Subject{NameID: &saml.NameID{Value: "b@acme.com"}}},
+			want:      identity{Email: "b@acme.com"},
+		},
+		{
+			name:      "opaque name id",
+			assertion: saml.Assertion{Subject: &saml.Subject{NameID: &saml.NameID{Value: "00u1abcd"}}},
+			want:      identity{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := samlIdentity(&tt.assertion); got != tt.want {
+				t.Errorf("samlIdentity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a single JWT key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+
+	method    jwt.SigningMethod
+	signKey   any // []byte for HMAC, private key otherwise
+	verifyKey any // []byte for HMAC, public key otherwise
+}
+
+// NewHMACKey returns an HS256 key, the kid is derived from the secret so it is stable across restarts
+func NewHMACKey(secret string) *Key {
+	sum := sha256.Sum256([]byte(secret))
+	return &Key{
+		ID:        "hs-" + hex.EncodeToString(sum[:6]),
+		Algorithm: AlgHS256,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// LoadKey reads a PEM encoded private or public key from path.
+// Public-only keys can verify tokens but can't be used as the signing key.
+func LoadKey(id, alg, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key %s: %w", id, err)
+	}
+	return ParseKey(id, alg, data)
+}
+
+// ParseKey parses a PEM encoded private or public key for alg
+func ParseKey(id, alg string, data []byte) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key id cannot be empty")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", id)
+	}
+
+	parsed, err := parsePEMBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	k := &Key{ID: id, Algorithm: alg}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		k.signKey = signer
+		k.verifyKey = signer.Public()
+	} else {
+		k.verifyKey = parsed
+	}
+
+	// make sure the key type matches the algorithm
+	switch alg {
+	case AlgRS256:
+		pub, ok := k.verifyKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s: %s requires an RSA key", id, alg)
+		}
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		k.method = jwt.SigningMethodRS256
+	case AlgES256:
+		pub, ok := k.verifyKey.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("key %s: %s requires a P-256 EC key", id, alg)
+		}
+		k.method = jwt.SigningMethodES256
+	case AlgEdDSA:
+		if _, ok := k.verifyKey.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("key %s: %s requires an Ed25519 key", id, alg)
+		}
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q (expected %s|%s|%s)", id, alg, AlgRS256, AlgES256, AlgEdDSA)
+	}
+
+	return k, nil
+}
+
+// parsePEMBlock accepts PKCS#1, PKCS#8 and SEC1 private keys and PKIX public keys
+func parsePEMBlock(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// IsSymmetric reports whether the key is a shared secret
+func (k *Key) IsSymmetric() bool {
+	_, ok := k.verifyKey.([]byte)
+	return ok
+}
+
+// PublicKey returns the public key, nil for HMAC keys
+func (k *Key) PublicKey() crypto.PublicKey {
+	if k.IsSymmetric() {
+		return nil
+	}
+	return k.verifyKey
+}
+
+// KeySet holds all keys accepted for verification and the single key used for signing
+type KeySet struct {
+	signing *Key
+	keys    []*Key
+	byID    map[string]*Key
+}
+
+// NewKeySet builds a keyset, signingID selects the signing key and must reference a private key
+func NewKeySet(signingID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{byID: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.byID[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.byID[k.ID] = k
+		ks.keys = append(ks.keys, k)
+	}
+
+	signing, ok := ks.byID[signingID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("signing key %q has no private key", signingID)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+// WithSigningKey returns a keyset sharing the same verification keys but signing with kid
+func (ks *KeySet) WithSigningKey(kid string) (*KeySet, error) {
+	return NewKeySet(kid, ks.keys...)
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ks *KeySet) SigningKey() *Key {
+	return ks.signing
+}
+
+// Keys returns all verification keys
+func (ks *KeySet) Keys() []*Key {
+	return ks.keys
+}
+
+// Lookup returns the key for kid
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	k, ok := ks.byID[kid]
+	return k, ok
+}
+
+// Sign signs claims with the signing key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	return ks.SignWithType("", claims)
+}
+
+// SignWithType is Sign with an explicit typ header, e.g. "at+jwt" for OAuth access tokens
+func (ks *KeySet) SignWithType(typ string, claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(ks.signing.method, claims)
+	t.Header["kid"] = ks.signing.ID
+	if typ != "" {
+		t.Header["typ"] = typ
+	}
+	return t.SignedString(ks.signing.signKey)
+}
+
+// Algorithms returns the distinct algorithms of all keys, used to pin the parser
+func (ks *KeySet) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range ks.keys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	return algs
+}
+
+// Keyfunc resolves the verification key for a parsed token.
+// Tokens without a kid were issued before key rotation support and are checked against the HMAC keys.
+func (ks *KeySet) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		var set jwt.VerificationKeySet
+		for _, k := range ks.keys {
+			if k.IsSymmetric() {
+				set.Keys = append(set.Keys, k.verifyKey)
+			}
+		}
+		if len(set.Keys) == 0 || t.Method.Alg() != AlgHS256 {
+			return nil, errors.New("token has no kid")
+		}
+		return set, nil
+	}
+
+	k, ok := ks.byID[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("algorithm %s does not match key %q", t.Method.Alg(), kid)
+	}
+	return k.verifyKey, nil
+}
+
+// KeySetFromConfig builds the keyset from JWT_SECRET, JWT_PREVIOUS_SECRETS and JWT_KEYS
+func KeySetFromConfig(conf cfg.AuthConfig) (*KeySet, error) {
+	current := NewHMACKey(conf.JWTSecret)
+	keys := []*Key{current}
+
+	for _, secret := range conf.JWTPreviousSecrets {
+		prev := NewHMACKey(secret)
+		// drop the signing capability so an old secret can never mint tokens
+		prev.signKey = nil
+		keys = append(keys, prev)
+	}
+
+	for _, kc := range conf.JWTKeys {
+		k, err := LoadKey(kc.ID, kc.Algorithm, kc.PEMPath)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	signingID := conf.JWTSigningKeyID
+	if signingID == "" {
+		signingID = current.ID
+	}
+	return NewKeySet(signingID, keys...)
+}
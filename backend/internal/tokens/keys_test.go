@@ -0,0 +1,202 @@
+package tokens
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func pemKey(t *testing.T, priv any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func pemPublicKey(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKey384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		alg     string
+		pem     []byte
+		wantErr bool
+		canSign bool
+	}{
+		{name: "rsa private", alg: AlgRS256, pem: pemKey(t, rsaKey), canSign: true},
+		{name: "rsa public", alg: AlgRS256, pem: pemPublicKey(t, &rsaKey.PublicKey)},
+		{name: "ec private", alg: AlgES256, pem: pemKey(t, ecKey), canSign: true},
+		{name: "ed25519 private", alg: AlgEdDSA, pem: pemKey(t, edKey), canSign: true},
+		{name: "algorithm mismatch", alg: AlgRS256, pem: pemKey(t, ecKey), wantErr: true},
+		{name: "wrong curve", alg: AlgES256, pem: pemKey(t, ecKey384), wantErr: true},
+		{name: "unsupported algorithm", alg: "HS512", pem: pemKey(t, rsaKey), wantErr: true},
+		{name: "not pem", alg: AlgRS256, pem: []byte("nope"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKey("kid", tt.alg, tt.pem)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if k.CanSign() != tt.canSign {
+				t.Errorf("CanSign() = %v, want %v", k.CanSign(), tt.canSign)
+			}
+			if _, ok := k.JWK(); !ok {
+				t.Errorf("JWK() not available for asymmetric key")
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := NewHMACKey("old-secret")
+	newKey := NewHMACKey("new-secret")
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, err := ParseKey("ed-1", AlgEdDSA, pemKey(t, edPriv))
+	if err != nil {
+		t.Fatalf("ParseKey() error = %v", err)
+	}
+
+	oldSet, err := NewKeySet(oldKey.ID, oldKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	oldToken, err := oldSet.Sign(jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// rotate: sign with ed25519, keep both HMAC secrets for verification
+	ks, err := NewKeySet("ed-1", newKey, oldKey, edKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	newToken, err := ks.Sign(jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// legacy tokens issued before kid support
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user"}).
+		SignedString([]byte("old-secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	// token from a key that was dropped from the set
+	strangerSet, _ := NewKeySet(NewHMACKey("stranger").ID, NewHMACKey("stranger"))
+	strangerToken, _ := strangerSet.Sign(jwt.RegisteredClaims{Subject: "user"})
+
+	parser := jwt.NewParser(jwt.WithValidMethods(ks.Algorithms()))
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "token from previous key", token: oldToken},
+		{name: "token from signing key", token: newToken},
+		{name: "legacy token without kid", token: legacyToken},
+		{name: "unknown kid", token: strangerToken, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(tt.token, ks.Keyfunc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "ed-1" || jwks.Keys[0].Kty != "OKP" {
+		t.Errorf("JWKS() = %+v, want only the ed25519 public key", jwks)
+	}
+}
+
+func TestNewKeySetRejectsPublicSigningKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pub, err := ParseKey("rs-pub", AlgRS256, pemPublicKey(t, &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatalf("ParseKey() error = %v", err)
+	}
+
+	if _, err := NewKeySet("rs-pub", pub); err == nil {
+		t.Errorf("NewKeySet() expected error for public-only signing key")
+	}
+	if _, err := NewKeySet("missing", pub); err == nil {
+		t.Errorf("NewKeySet() expected error for unknown signing key")
+	}
+}
+
+func TestServiceSetAndGet(t *testing.T) {
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKey, err := ParseKey("es-1", AlgES256, pemKey(t, ecPriv))
+	if err != nil {
+		t.Fatalf("ParseKey() error = %v", err)
+	}
+	ks, err := NewKeySet("es-1", ecKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	svc := NewService(token.NewService(token.Opts{DisableXSRF: true, Issuer: "test"}), ks)
+
+	rec := httptest.NewRecorder()
+	_, err = svc.Set(rec, token.Claims{
+		User:             &token.User{ID: "local_123", Name: "Test"},
+		RegisteredClaims: jwt.RegisteredClaims{ID: "cid", Audience: []string{""}},
+	})
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/user", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	claims, tkn, err := svc.Get(req)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if claims.User == nil || claims.User.ID != "local_123" {
+		t.Errorf("Get() user = %+v, want local_123", claims.User)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(tkn, &token.Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	if parsed.Header["kid"] != "es-1" || parsed.Header["alg"] != AlgES256 {
+		t.Errorf("token header = %v, want kid es-1 and alg ES256", parsed.Header)
+	}
+}
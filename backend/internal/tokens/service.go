@@ -0,0 +1,249 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/v2/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Service is a drop-in replacement for the go-pkgz token service that signs with a KeySet.
+// go-pkgz always signs HS256 with a single secret, so Token, Parse, Set and Get are
+// reimplemented here, cookie handling and options are shared with the wrapped service.
+type Service struct {
+	*token.Service
+	Keys *KeySet
+}
+
+// NewService wraps the go-pkgz token service (use authService.TokenService()) with keys
+func NewService(base *token.Service, keys *KeySet) *Service {
+	return &Service{Service: base, Keys: keys}
+}
+
+// Token makes a signed token with claims, the header carries the signing key's kid
+func (s *Service) Token(claims token.Claims) (string, error) {
+	// update claims with ClaimsUpdFunc defined by consumer
+	if s.ClaimsUpd != nil {
+		claims = s.ClaimsUpd.Update(claims)
+	}
+
+	if err := s.checkAuds(claims); err != nil {
+		return "", fmt.Errorf("aud rejected: %w", err)
+	}
+
+	tokenString, err := s.Keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("can't sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// Parse token string and verify. Not checking for expiration
+func (s *Service) Parse(tokenString string) (token.Claims, error) {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation(), jwt.WithValidMethods(s.Keys.Algorithms()))
+
+	t, err := parser.ParseWithClaims(tokenString, &token.Claims{}, s.Keys.Keyfunc)
+	if err != nil {
+		return token.Claims{}, fmt.Errorf("can't parse token: %w", err)
+	}
+
+	claims, ok := t.Claims.(*token.Claims)
+	if !ok {
+		return token.Claims{}, fmt.Errorf("invalid token")
+	}
+
+	if err := s.checkAuds(*claims); err != nil {
+		return token.Claims{}, fmt.Errorf("aud rejected: %w", err)
+	}
+	return *claims, validate(claims)
+}
+
+// Set creates token cookie with xsrf cookie and puts it to ResponseWriter
+func (s *Service) Set(w http.ResponseWriter, claims token.Claims) (token.Claims, error) {
+	nowUnix := time.Now().Unix()
+
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Unix() == 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(nowUnix, 0).Add(s.TokenDuration))
+	}
+
+	if claims.Issuer == "" {
+		claims.Issuer = s.Issuer
+	}
+
+	if !s.DisableIAT {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(nowUnix, 0))
+	}
+
+	tokenString, err := s.Token(claims)
+	if err != nil {
+		return token.Claims{}, fmt.Errorf("failed to make token token: %w", err)
+	}
+
+	if s.SendJWTHeader {
+		w.Header().Set(s.JWTHeaderKey, tokenString)
+		return claims, nil
+	}
+
+	cookieExpiration := 0 // session cookie
+	if !claims.SessionOnly && claims.Handshake == nil {
+		cookieExpiration = int(s.CookieDuration.Seconds())
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: s.JWTCookieName, Value: tokenString, HttpOnly: true, Path: "/",
+		Domain: s.JWTCookieDomain, MaxAge: cookieExpiration, Secure: s.SecureCookies, SameSite: s.SameSite})
+
+	http.SetCookie(w, &http.Cookie{Name: s.XSRFCookieName, Value: claims.ID, HttpOnly: false, Path: "/",
+		Domain: s.JWTCookieDomain, MaxAge: cookieExpiration, Secure: s.SecureCookies, SameSite: s.SameSite})
+
+	return claims, nil
+}
+
+// Get token from url, header or cookie. If cookie used, verify xsrf token to match
+func (s *Service) Get(r *http.Request) (token.Claims, string, error) {
+	fromCookie := false
+	tokenString := ""
+
+	// try to get from "token" query param
+	if tkQuery := r.URL.Query().Get(s.JWTQuery); tkQuery != "" {
+		tokenString = tkQuery
+	}
+
+	// try to get from JWT header
+	if tokenHeader := r.Header.Get(s.JWTHeaderKey); tokenHeader != "" && tokenString == "" {
+		tokenString = tokenHeader
+	}
+
+	// try to get from JWT cookie
+	if tokenString == "" {
+		fromCookie = true
+		jc, err := r.Cookie(s.JWTCookieName)
+		if err != nil {
+			return token.Claims{}, "", fmt.Errorf("token cookie was not presented: %w", err)
+		}
+		tokenString = jc.Value
+	}
+
+	claims, err := s.Parse(tokenString)
+	if err != nil {
+		return token.Claims{}, "", fmt.Errorf("failed to get token: %w", err)
+	}
+
+	// promote claim's aud to User.Audience
+	if claims.User != nil {
+		if len(claims.Audience) != 1 {
+			return token.Claims{}, "", fmt.Errorf("aud is not of size 1")
+		}
+		claims.User.Audience = claims.Audience[0]
+	}
+
+	if !fromCookie && s.IsExpired(claims) {
+		return token.Claims{}, "", fmt.Errorf("token expired")
+	}
+
+	if s.DisableXSRF || slices.Contains(s.XSRFIgnoreMethods, r.Method) {
+		return claims, tokenString, nil
+	}
+
+	if fromCookie && claims.User != nil {
+		if claims.ID != r.Header.Get(s.XSRFHeaderKey) {
+			return token.Claims{}, "", fmt.Errorf("xsrf mismatch")
+		}
+	}
+
+	return claims, tokenString, nil
+}
+
+// GetFromCookie returns the session from the JWT cookie without the XSRF check.
+// Only for top-level browser navigations (e.g. OIDC /authorize) which can't send headers,
+// state changing requests must verify their own CSRF token.
+func (s *Service) GetFromCookie(r *http.Request) (token.Claims, error) {
+	jc, err := r.Cookie(s.JWTCookieName)
+	if err != nil {
+		return token.Claims{}, fmt.Errorf("token cookie was not presented: %w", err)
+	}
+
+	claims, err := s.Parse(jc.Value)
+	if err != nil {
+		return token.Claims{}, fmt.Errorf("failed to get token: %w", err)
+	}
+	if claims.User == nil {
+		return token.Claims{}, fmt.Errorf("user is nil")
+	}
+	if s.IsExpired(claims) {
+		return token.Claims{}, fmt.Errorf("token expired")
+	}
+	return claims, nil
+}
+
+// UserHandler shows the logged-in user, GET /auth/user
+// It replaces the go-pkgz route which can only parse HS256 tokens.
+func (s *Service) UserHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _, err := s.Get(r)
+	if err != nil || claims.User == nil {
+		msg := "user is nil"
+		if err != nil {
+			msg = err.Error()
+		}
+		renderJSON(w, http.StatusUnauthorized, map[string]string{"error": msg})
+		return
+	}
+	renderJSON(w, http.StatusOK, claims.User)
+}
+
+// StatusHandler shows the login status, GET /auth/status
+func (s *Service) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _, err := s.Get(r)
+	if err != nil || claims.User == nil {
+		renderJSON(w, http.StatusOK, map[string]string{"status": "not logged in"})
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]string{"status": "logged in", "user": claims.User.Name})
+}
+
+// checkAuds verifies claims.Audience is in the list of allowed audiences, if one is configured
+func (s *Service) checkAuds(claims token.Claims) error {
+	if s.AudienceReader == nil { // lack of any allowed means any
+		return nil
+	}
+	if len(claims.Audience) == 0 {
+		return fmt.Errorf("no audience provided")
+	}
+
+	auds, err := s.AudienceReader.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get auds: %w", err)
+	}
+	for _, a := range auds {
+		if strings.EqualFold(a, claims.Audience[0]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("aud %q not allowed", claims.Audience[0])
+}
+
+// validate checks registered claims, an expired token alone is not an error as it can be refreshed
+func validate(claims *token.Claims) error {
+	err := jwt.NewValidator().Validate(claims)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		if uw, ok := err.(interface{ Unwrap() []error }); ok && len(uw.Unwrap()) == 1 {
+			return nil
+		}
+	}
+	return err
+}
+
+func renderJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
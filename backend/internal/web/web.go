@@ -0,0 +1,231 @@
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/go-app-starter/internal/apperr"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/rs/zerolog"
+)
+
+// dist holds the Flutter build/web output copied in by `make build-web`,
+// a checkout without a build only contains the .gitignore.
+//
+//go:embed all:dist
+var dist embed.FS
+
+const indexFile = "index.html"
+
+// hashedName matches file names with a content hash like main.3f2a9c1d.js, those never change
+var hashedName = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[A-Za-z0-9]+$`)
+
+// encodings are tried in order, the variant is served if the client accepts it and name+ext exists
+var encodings = []struct{ name, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Embedded returns the embedded build, ok is false when the binary was built without one
+func Embedded() (fs.FS, bool) {
+	fsys, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(fsys, indexFile); err != nil {
+		return nil, false
+	}
+	return fsys, true
+}
+
+// Options configure the Server
+type Options struct {
+	// Path prefixes owned by the API, unknown paths below them are a 404 instead of the app
+	ReservedPrefixes []string
+	// Access log level of static file requests, zerolog.Disabled leaves them out
+	LogLevel zerolog.Level
+	// Policy for the app's pages, nil keeps the one set by the security headers middleware
+	CSP *middleware.CSP
+}
+
+// Server serves a single page app: files that exist are served with cache headers and
+// precompressed variants, every other path gets index.html so client side routing works.
+type Server struct {
+	fsys  fs.FS
+	opts  Options
+	etags sync.Map // name, modtime and size to ETag
+}
+
+// New creates a server for the files in fsys
+func New(fsys fs.FS, opts Options) *Server {
+	return &Server{fsys: fsys, opts: opts}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		apperr.Write(w, r, &apperr.Error{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "method not allowed"})
+		return
+	}
+	for _, prefix := range s.opts.ReservedPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			apperr.Write(w, r, apperr.NotFound(apperr.CodeNotFound, "not found"))
+			return
+		}
+	}
+	logger.SetAccessLevel(r.Context(), s.opts.LogLevel)
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+	if info, err := fs.Stat(s.fsys, name); err != nil || info.IsDir() {
+		// paths that look like files are real misses, anything else is a route of the app
+		if path.Ext(name) != "" {
+			apperr.Write(w, r, apperr.NotFound(apperr.CodeNotFound, "not found"))
+			return
+		}
+		name = indexFile
+	}
+
+	if err := s.serveFile(w, r, name); err != nil {
+		apperr.Write(w, r, apperr.Internal(fmt.Errorf("serve %s: %w", name, err)))
+	}
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string) error {
+	h := w.Header()
+	switch {
+	case name == indexFile:
+		h.Set("Cache-Control", "no-cache")
+		if s.opts.CSP != nil {
+			setCSP(h, s.opts.CSP.String(middleware.CSPNonce(r.Context())))
+		}
+	case hashedName.MatchString(name):
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		// unhashed assets like main.dart.js change between releases, revalidate with the ETag
+		h.Set("Cache-Control", "no-cache")
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	h.Set("Content-Type", ctype)
+
+	served := name
+	hasVariant := false
+	for _, enc := range encodings {
+		if _, err := fs.Stat(s.fsys, name+enc.ext); err != nil {
+			continue
+		}
+		hasVariant = true
+		if served == name && accepts(r.Header.Get("Accept-Encoding"), enc.name) {
+			served = name + enc.ext
+			h.Set("Content-Encoding", enc.name)
+		}
+	}
+	if hasVariant {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	f, err := s.fsys.Open(served)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		return errors.New("file does not support seeking")
+	}
+
+	etag, err := s.etag(served, info, rs)
+	if err != nil {
+		return err
+	}
+	h.Set("ETag", etag)
+
+	// embedded files have no modification time, ServeContent then relies on the ETag alone
+	http.ServeContent(w, r, served, info.ModTime(), rs)
+	return nil
+}
+
+// etag hashes the file content once per name, modification time and size
+func (s *Server) etag(name string, info fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	key := name + "|" + info.ModTime().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(info.Size(), 10)
+	if v, ok := s.etags.Load(key); ok {
+		return v.(string), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:12]) + `"`
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+// setCSP replaces the policy set by the security headers middleware, keeping its report-only mode
+func setCSP(h http.Header, policy string) {
+	if h.Get("Content-Security-Policy-Report-Only") != "" {
+		h.Set("Content-Security-Policy-Report-Only", policy)
+		return
+	}
+	h.Set("Content-Security-Policy", policy)
+}
+
+// accepts reports whether an Accept-Encoding header allows enc, q=0 rules it out
+func accepts(header, enc string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case enc:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
+
+// FlutterCSP is the default policy loosened for the Flutter web engine: it compiles
+// WebAssembly, injects inline styles and loads CanvasKit and fonts from Google's CDN.
+// Self host CanvasKit and fonts to drop the gstatic sources.
+func FlutterCSP() *middleware.CSP {
+	return middleware.DefaultCSP().
+		Set("script-src", "'self'", "'wasm-unsafe-eval'", "https://www.gstatic.com").
+		Set("style-src", "'self'", "'unsafe-inline'").
+		Set("font-src", "'self'", "https://fonts.gstatic.com").
+		Set("connect-src", "'self'", "https://www.gstatic.com", "https://fonts.gstatic.com").
+		Set("img-src", "'self'", "data:", "blob:")
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	cfg "github.com/anish-chanda/go-app-starter/internal/config"
+	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/rs/zerolog"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":               {Data: []byte("<html>app</html>")},
+		"main.dart.js":             {Data: []byte("main()")},
+		"main.dart.js.gz":          {Data: []byte("gzipped")},
+		"main.dart.js.br":          {Data: []byte("brotli")},
+		"assets/logo.1a2b3c4d.png": {Data: []byte("png")},
+		"assets/fonts/font.ttf":    {Data: []byte("font")},
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := New(testFS(), Options{ReservedPrefixes: []string{"/api/"}})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		wantStatus     int
+		wantBody       string
+		wantCache      string
+		wantEncoding   string
+		wantType       string
+	}{
+		{name: "root", path: "/", wantStatus: http.StatusOK, wantBody: "<html>app</html>", wantCache: "no-cache", wantType: "text/html; charset=utf-8"},
+		{name: "spa route", path: "/dashboard/settings", wantStatus: http.StatusOK, wantBody: "<html>app</html>", wantCache: "no-cache"},
+		{name: "directory falls back", path: "/assets", wantStatus: http.StatusOK, wantBody: "<html>app</html>"},
+		{name: "missing asset", path: "/missing.js", wantStatus: http.StatusNotFound},
+		{name: "reserved prefix", path: "/api/nope", wantStatus: http.StatusNotFound},
+		{name: "hashed asset", path: "/assets/logo.1a2b3c4d.png", wantStatus: http.StatusOK, wantBody: "png",
+			wantCache: "public, max-age=31536000, immutable", wantType: "image/png"},
+		{name: "unhashed asset", path: "/assets/fonts/font.ttf", wantStatus: http.StatusOK, wantBody: "font", wantCache: "no-cache"},
+		{name: "brotli preferred", path: "/main.dart.js", acceptEncoding: "gzip, deflate, br", wantStatus: http.StatusOK,
+			wantBody: "brotli", wantEncoding: "br", wantType: "text/javascript; charset=utf-8"},
+		{name: "gzip", path: "/main.dart.js", acceptEncoding: "gzip", wantStatus: http.StatusOK, wantBody: "gzipped", wantEncoding: "gzip"},
+		{name: "brotli refused", path: "/main.dart.js", acceptEncoding: "br;q=0, gzip;q=0.5", wantStatus: http.StatusOK,
+			wantBody: "gzipped", wantEncoding: "gzip"},
+		{name: "identity", path: "/main.dart.js", wantStatus: http.StatusOK, wantBody: "main()"},
+		{name: "post", method: http.MethodPost, path: "/", wantStatus: http.StatusMethodNotAllowed},
+		{name: "path traversal", path: "/../../etc/passwd", wantStatus: http.StatusOK, wantBody: "<html>app</html>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			req.URL.Path = tt.path
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantCache != "" && rec.Header().Get("Cache-Control") != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", rec.Header().Get("Cache-Control"), tt.wantCache)
+			}
+			if rec.Header().Get("Content-Encoding") != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", rec.Header().Get("Content-Encoding"), tt.wantEncoding)
+			}
+			if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+			if tt.path == "/main.dart.js" && rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	s := New(testFS(), Options{})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/main.dart.js", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/main.dart.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+}
+
+func TestServerCSP(t *testing.T) {
+	s := New(testFS(), Options{CSP: FlutterCSP()})
+	h := middleware.SecurityHeaders(middleware.DefaultSecurityHeaders())(s)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "'wasm-unsafe-eval'") {
+		t.Errorf("index CSP = %q, want the Flutter policy", csp)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/main.dart.js", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); strings.Contains(csp, "'wasm-unsafe-eval'") {
+		t.Errorf("asset CSP = %q, want the default policy", csp)
+	}
+}
+
+func TestServerAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger.Init(cfg.LogConfig{Mode: cfg.LogModeJSON, Level: zerolog.InfoLevel, Out: &logs})
+	h := logger.Http(New(testFS(), Options{ReservedPrefixes: []string{"/api/"}, LogLevel: zerolog.DebugLevel}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/main.dart.js", nil))
+	if logs.Len() != 0 {
+		t.Errorf("static request logged below the debug level: %s", logs.String())
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/nope", nil))
+	if !strings.Contains(logs.String(), "404 GET /api/nope") {
+		t.Errorf("request outside the app not logged: %s", logs.String())
+	}
+}
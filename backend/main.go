@@ -4,127 +4,571 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/anish-chanda/go-app-starter/internal/admin"
+	"github.com/anish-chanda/go-app-starter/internal/app"
+	"github.com/anish-chanda/go-app-starter/internal/certs"
+	"github.com/anish-chanda/go-app-starter/internal/clientip"
 	cfg "github.com/anish-chanda/go-app-starter/internal/config"
 	"github.com/anish-chanda/go-app-starter/internal/db"
 	"github.com/anish-chanda/go-app-starter/internal/handlers"
+	"github.com/anish-chanda/go-app-starter/internal/health"
 	"github.com/anish-chanda/go-app-starter/internal/logger"
+	"github.com/anish-chanda/go-app-starter/internal/mailer"
+	"github.com/anish-chanda/go-app-starter/internal/metrics"
+	"github.com/anish-chanda/go-app-starter/internal/middleware"
+	"github.com/anish-chanda/go-app-starter/internal/module"
+	"github.com/anish-chanda/go-app-starter/internal/oidc"
+	"github.com/anish-chanda/go-app-starter/internal/ratelimit"
+	"github.com/anish-chanda/go-app-starter/internal/router"
+	"github.com/anish-chanda/go-app-starter/internal/signup"
+	"github.com/anish-chanda/go-app-starter/internal/sso"
+	"github.com/anish-chanda/go-app-starter/internal/tokens"
+	"github.com/anish-chanda/go-app-starter/internal/web"
 	"github.com/anish-chanda/go-app-starter/migrations"
 	authpkg "github.com/go-pkgz/auth/v2"
+	authlogger "github.com/go-pkgz/auth/v2/logger"
 	"github.com/go-pkgz/auth/v2/provider"
 	"github.com/go-pkgz/auth/v2/token"
 )
 
 const (
-	shutdownTimeout    = 10 * time.Second
 	startupTimeout     = 5 * time.Second
 	dbMigrationTimeout = 60 * time.Second
+	workerStopSlack    = 10 * time.Second // on top of the drain and shutdown timeout for workers and the database
+	authMaxBodyBytes   = 64 << 10         // 64 KiB
 )
 
 func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
 
+// runServe runs the API until SIGINT or SIGTERM
+func runServe(config *cfg.Config) error {
 	// Cancel ctx on SIGINT/SIGTERM
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	go func() {
+		// a second signal exits right away instead of waiting for the drain
+		<-ctx.Done()
+		stop()
+	}()
 
-	config, err := cfg.LoadConfig()
+	logger.L().Info().Msg("Application started")
+
+	a, _, err := newApp(config)
 	if err != nil {
-		panic(fmt.Sprintf("failed to load config: %v", err))
+		logger.L().Error().Err(err).Msg("Failed to setup application")
+		return fmt.Errorf("setup application: %w", err)
 	}
 
-	// initialize logger
-	logger.Init(config.Log)
+	stopTimeout := time.Duration(config.Server.DrainPeriod+config.Server.ShutdownTimeout)*time.Second + workerStopSlack
+	if err := a.Run(ctx, stopTimeout); err != nil {
+		logger.L().Error().Err(err).Msg("Application failed")
+		return err
+	}
+	logger.L().Info().Msg("Shutdown complete")
+	return nil
+}
 
-	logger.L().Info().Msg("Application started")
+// newApp builds every component without touching the network, connections and listeners are
+// opened by the start hooks. Stop hooks run in reverse: the HTTP server drains first, the
+// database the others use goes last.
+func newApp(config *cfg.Config) (*app.App, *router.Router, error) {
+	a := app.New()
 
-	startCtx, cancel := context.WithTimeout(ctx, startupTimeout)
-	defer cancel()
+	database, err := db.New(config.Db, logger.L())
+	if err != nil {
+		return nil, nil, fmt.Errorf("setup database: %w", err)
+	}
+	a.Register(app.Component{
+		Name: "db",
+		Start: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, startupTimeout)
+			defer cancel()
+			if err := database.Pool.Ping(ctx); err != nil {
+				database.Pool.Close()
+				return err
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			logger.L().Info().Int32("connections", database.Pool.Stat().TotalConns()).Msg("Closing database pool")
+			database.Pool.Close()
+			return nil
+		},
+	})
 
-	database, err := db.NewPostgresDb(config.Db, startCtx, logger.L())
+	// setup auth service
+	// load jwt keys, a bad key file should stop startup rather than break logins
+	keySet, err := tokens.KeySetFromConfig(config.Auth)
 	if err != nil {
-		logger.L().Fatal().Err(err).Msg("Failed to connect to database")
-		return
+		return nil, nil, fmt.Errorf("load JWT keys: %w", err)
 	}
+	logger.L().Info().Str("kid", keySet.SigningKey().ID).Str("alg", keySet.SigningKey().Algorithm).
+		Int("keys", len(keySet.Keys())).Msg("JWT keys loaded")
 
-	// run db migrations
-	migCtx, cancel := context.WithTimeout(ctx, dbMigrationTimeout)
-	defer cancel()
-	if err := migrations.RunMigrations(migCtx, database.Pool, logger.L()); err != nil {
-		logger.L().Fatal().Err(err).Msg("Failed to run database migrations")
-		return
+	h := handlers.New(database, signup.New(config.Auth.Signup))
+	mail := mailer.New(config.Mail, logger.L())
+	authService, tokenService := setupAuth(config.Auth, config.PublicURL, h, keySet, mail)
+
+	// optional OpenID Connect provider for internal apps
+	var oidcProvider *oidc.Provider
+	if config.Auth.OIDC.Enabled {
+		oidcProvider, err = oidc.New(config.Auth.OIDC, config.PublicURL, database, tokenService,
+			provider.CredCheckerFunc(h.LocalCredChecker))
+		if err != nil {
+			return nil, nil, fmt.Errorf("setup OIDC provider: %w", err)
+		}
 	}
 
-	// setup auth service
-	h := handlers.New(database)
-	authService := setupAuth(config.Auth, h)
+	// optional enterprise sso, identity providers are configured per organization in the database
+	var ssoService *sso.Service
+	if config.Auth.SSO.Enabled {
+		ssoService, err = sso.New(config.Auth.SSO, config.PublicURL, database, tokenService)
+		if err != nil {
+			return nil, nil, fmt.Errorf("setup SSO: %w", err)
+		}
+	}
 
-	server := buildServer(config.Host, config.APIPort, database, authService)
+	// readiness fails on critical checks only, the rest report the instance as degraded
+	checks := health.New(time.Duration(config.Health.CacheTTL) * time.Second)
+	checks.Register(health.Check{Name: "db", Run: database.Pool.Ping, Timeout: time.Second, Critical: true})
+	var migrationOutcome atomic.Pointer[migrations.Outcome]
+	checks.Register(health.Check{Name: "migrations", Critical: true, Run: func(ctx context.Context) error {
+		return migrations.CheckApplied(ctx, database.Pool, migrations.Core())
+	}, Detail: func() string {
+		if o := migrationOutcome.Load(); o != nil {
+			return o.String()
+		}
+		if !config.Db.AutoMigrate {
+			return "automatic migrations disabled"
+		}
+		return ""
+	}})
+	if smtp, ok := mail.(*mailer.SMTPMailer); ok {
+		checks.Register(health.Check{Name: "mailer", Run: smtp.Ping, Timeout: 5 * time.Second})
+	}
+	if config.Health.DiskPath != "" {
+		checks.Register(health.Check{Name: "disk", Run: health.DiskSpace(config.Health.DiskPath, uint64(config.Health.DiskMinFree)<<20)})
+	}
+
+	// feature modules registered by the imports in modules.go
+	mods := module.All()
+	var moduleMigrations []migrations.Source
+	for _, m := range mods {
+		l := logger.L().With().Str("module", m.Name()).Logger()
+		err := m.Init(module.Deps{
+			DB:     database,
+			Env:    cfg.Env{Prefix: module.EnvPrefix(m)},
+			Logger: &l,
+			Health: checks,
+			Mailer: mail,
+			Tokens: tokenService,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("init module %s: %w", m.Name(), err)
+		}
+		if src, ok := module.MigrationSource(m); ok {
+			moduleMigrations = append(moduleMigrations, src)
+			checks.Register(health.Check{Name: "migrations_" + m.Name(), Critical: true, Run: func(ctx context.Context) error {
+				return migrations.CheckApplied(ctx, database.Pool, src)
+			}})
+		}
+		l.Info().Msg("Module loaded")
+	}
+	// one instance migrates while the others wait for it, module tables may reference core
+	// tables so they migrate after them
+	migrationSources := append([]migrations.Source{migrations.Core()}, moduleMigrations...)
+	a.Register(app.Component{
+		Name:      "migrations",
+		DependsOn: []string{"db"},
+		Start: func(ctx context.Context) error {
+			if !config.Db.AutoMigrate {
+				logger.L().Info().Msg("Automatic migrations disabled, run migrate up before serving")
+				return nil
+			}
+			wait := time.Duration(config.Db.MigrationWait) * time.Second
+			ctx, cancel := context.WithTimeout(ctx, wait+dbMigrationTimeout)
+			defer cancel()
+			outcome, err := migrations.RunLocked(ctx, database.Pool, logger.L(), migrationSources, wait)
+			if err != nil {
+				return err
+			}
+			migrationOutcome.Store(&outcome)
+			return nil
+		},
+	})
+
+	// rate limits are declared per route in buildServer, a nil limiter leaves them off
+	var limiter *ratelimit.Limiter
+	var limitStore ratelimit.Store
+	if config.Server.RateLimit.Enabled {
+		limitStore = ratelimit.NewMemoryStore()
+		if config.Server.RateLimit.Store == cfg.RateLimitStorePostgres {
+			limitStore = database
+		}
+		limiter = ratelimit.New(limitStore)
+	}
+
+	// operational endpoints get their own listener, requests are only counted when it serves them
+	var appMetrics *metrics.Metrics
+	var adminServer *http.Server
+	if config.Admin.Enabled {
+		appMetrics = metrics.New()
+		adminServer = admin.NewServer(config.Admin.Addr, admin.Options{
+			Metrics: appMetrics.Handler(),
+			Pprof:   config.Admin.Pprof,
+			Health:  checks.ReadyHandler(true),
+		})
+	}
 
-	// Run server
+	server, rt := buildServer(config.Host, config.APIPort, config.PublicURL, config.Server, config.Auth.MagicLink.Enabled, h, checks, authService, tokenService, oidcProvider, ssoService, limiter, appMetrics, mods)
+
+	// serve https directly, certificates are reloaded when the files change or on SIGHUP
+	var reloader *certs.Reloader
+	if config.Server.TLS.Enabled {
+		reloader, err = certs.NewReloader(config.Server.TLS)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		server.TLSConfig = reloader.TLSConfig()
+	}
+
+	// background workers run until the servers are down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	a.Register(app.Component{
+		Name:      "workers",
+		DependsOn: []string{"migrations"},
+		Start: func(context.Context) error {
+			for _, m := range mods {
+				if w, ok := m.(module.Worker); ok {
+					for _, job := range w.Jobs() {
+						workers.Go(func() { module.RunJob(workerCtx, m.Name(), job) })
+					}
+				}
+			}
+			if limitStore != nil {
+				workers.Go(func() { ratelimit.RunCleanup(workerCtx, limitStore, time.Minute) })
+			}
+			if reloader != nil {
+				workers.Go(func() { reloader.Watch(workerCtx, time.Duration(config.Server.TLS.ReloadInterval)*time.Second) })
+				workers.Go(func() { reloadOnHangup(workerCtx, reloader) })
+			}
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			logger.L().Info().Msg("Stopping background workers")
+			stopWorkers()
+			done := make(chan struct{})
+			go func() {
+				workers.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return fmt.Errorf("background workers didn't stop: %w", ctx.Err())
+			}
+		},
+	})
+
+	// the admin server stays up while the public one drains so metrics and profiles cover the shutdown
+	httpDeps := []string{"migrations", "workers"}
+	if adminServer != nil {
+		a.Register(app.Component{
+			Name: "admin",
+			Start: func(context.Context) error {
+				return listen(a, adminServer, "admin server")
+			},
+			Stop: func(ctx context.Context) error {
+				logger.L().Info().Msg("Stopping admin server")
+				if err := adminServer.Shutdown(ctx); err != nil {
+					_ = adminServer.Close()
+				}
+				return nil
+			},
+		})
+		httpDeps = append(httpDeps, "admin")
+	}
+
+	a.Register(app.Component{
+		Name:      "http",
+		DependsOn: httpDeps,
+		Start: func(context.Context) error {
+			return listen(a, server, "server")
+		},
+		Stop: func(context.Context) error {
+			drainAndShutdown(config.Server, checks, server)
+			return nil
+		},
+	})
+
+	return a, rt, nil
+}
+
+// listen binds the address right away so a port in use fails startup, then serves in the background
+func listen(a *app.App, server *http.Server, name string) error {
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
 	go func() {
-		logger.L().Info().Msgf("Starting server on %s", server.Addr)
-		err := server.ListenAndServe()
+		var err error
+		if server.TLSConfig != nil {
+			logger.L().Info().Msgf("Starting %s on %s with TLS", name, server.Addr)
+			// the certificate comes from TLSConfig
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			logger.L().Info().Msgf("Starting %s on %s", name, server.Addr)
+			err = server.Serve(ln)
+		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.L().Fatal().Err(err).Msg("Server failed")
+			a.Fail(fmt.Errorf("%s: %w", name, err))
 		}
 	}()
+	return nil
+}
 
-	// Wait for signal
-	<-ctx.Done()
-	logger.L().Warn().Msg("Shutting down server...")
+// reloadOnHangup reloads the certificate on SIGHUP until ctx is canceled
+func reloadOnHangup(ctx context.Context, reloader *certs.Reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := reloader.Reload(); err != nil {
+				logger.L().Error().Err(err).Msg("Failed to reload TLS certificate, keeping the current one")
+			}
+		}
+	}
+}
+
+// drainAndShutdown fails readiness so load balancers stop routing here, waits for them to
+// notice, then gives in-flight requests the shutdown timeout to finish
+func drainAndShutdown(conf cfg.ServerConfig, checks *health.Registry, server *http.Server) {
+	l := logger.L().With().Str("component", "shutdown").Logger()
+
+	drain := time.Duration(conf.DrainPeriod) * time.Second
+	l.Warn().Dur("drain_period", drain).Msg("Shutting down, readiness is failing")
+	checks.Drain()
+	// clients reconnect for their next request and land on another instance
+	server.SetKeepAlivesEnabled(false)
+	time.Sleep(drain)
 
 	// Give active requests time to finish
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	timeout := time.Duration(conf.ShutdownTimeout) * time.Second
+	l.Info().Dur("timeout", timeout).Msg("Stopping HTTP server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		// Shutdown timed out or failed, Close() force-closes connections.
-		logger.L().Error().Err(err).Msg("Graceful shutdown failed, forcing close")
+		l.Error().Err(err).Msg("Graceful shutdown failed, forcing close")
 		_ = server.Close()
 	}
-
-	// Now close DB pool
-	logger.L().Debug().Msgf("closing %d database connections", database.Pool.Stat().TotalConns())
-	database.Pool.Close()
-
-	logger.L().Info().Msg("Shutdown complete")
-
 }
 
-func buildServer(host string, port int, database *db.PostgresDB, authService *authpkg.Service) *http.Server {
-	h := handlers.New(database)
+func buildServer(host string, port int, publicURL string, conf cfg.ServerConfig, magicLinkEnabled bool, h *handlers.Handler, checks *health.Registry,
+	authService *authpkg.Service, tokenService *tokens.Service, oidcProvider *oidc.Provider, ssoService *sso.Service,
+	limiter *ratelimit.Limiter, appMetrics *metrics.Metrics, mods []module.Module) (*http.Server, *router.Router) {
+	// every route gets the default deadline, register a route with its own chain to change it
+	route := middleware.New(middleware.Timeout(time.Duration(conf.HandlerTimeout) * time.Second))
+	// auth endpoints only take small JSON or form bodies
+	authRoute := route.Append(middleware.MaxBytes(authMaxBodyBytes))
 
-	api := http.NewServeMux()
-	api.HandleFunc("GET /health", h.Health)
-	api.HandleFunc("GET /hello", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Hello, World!"))
-	})
+	// per client limits on endpoints that create accounts, check passwords or send email
+	signupLimit := limiter.Middleware("signup", ratelimit.PerHour(30), ratelimit.ByIP)
+	loginLimit := limiter.Middleware("login",
+		ratelimit.Limit{Requests: 20, Window: time.Minute, Algorithm: ratelimit.SlidingWindow}, ratelimit.ByIP)
+	magicLinkLimit := limiter.Middleware("magic_link", ratelimit.PerHour(10), ratelimit.ByIP)
 
 	mainMux := http.NewServeMux()
-	mainMux.Handle("/api/", http.StripPrefix("/api", api))
+	// TODO: Change the title based on your project
+	rt := router.New(mainMux, router.Info{Title: "App API", Version: "1.0.0"})
+
+	// probes are cached by the registry, so they don't reach the database on every request
+	rt.Handle("GET", "/api/health", route.ThenFunc(checks.TextHandler())).
+		Summary("Check that the API is ready, for probes that only look at the status").Tags("health").
+		Response(http.StatusOK, "Ready", "OK").
+		Problems(http.StatusServiceUnavailable)
+	rt.Handle("GET", "/api/health/live", route.ThenFunc(checks.LiveHandler(false))).
+		Summary("Check that the process works, a failure means it should be restarted").Tags("health").
+		Response(http.StatusOK, "Alive", health.Report{}).
+		Response(http.StatusServiceUnavailable, "A liveness check failed", health.Report{})
+	rt.Handle("GET", "/api/health/ready", route.ThenFunc(checks.ReadyHandler(false))).
+		Summary("Check that the instance can serve traffic").Tags("health").
+		Response(http.StatusOK, "Ready, status is degraded when a non-critical check fails", health.Report{}).
+		Response(http.StatusServiceUnavailable, "A critical check failed", health.Report{})
+	for _, m := range mods {
+		m.Routes(rt, route)
+	}
+
+	// the document describes every route registered on rt, so it is built lazily on first request
+	rt.Mount("GET /api/openapi.json", route.Then(rt.OpenAPIHandler(publicURL)))
+	if conf.DocsUI {
+		rt.Mount("GET /api/docs", route.Then(router.DocsHandler("/api/openapi.json")))
+	}
 
 	// mount auth handlers
 	// TODO: handle avatars
 	authHandlers, _ := authService.Handlers()
-	mainMux.HandleFunc("POST /auth/local/signup", h.SignupHandler)
-	mainMux.Handle("/auth/", http.StripPrefix("/auth", authHandlers))
+	authMount := http.StripPrefix("/auth", authHandlers)
+	rt.Handle("POST", "/auth/local/signup", authRoute.Append(signupLimit).ThenFunc(h.SignupHandler)).
+		Summary("Create an account with email and password").Tags("auth").
+		Request(handlers.SignupRequest{}).
+		Response(http.StatusCreated, "Account created, log in to get a session", handlers.SignupResponse{}).
+		Problems(http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType, http.StatusTooManyRequests)
+	// go-pkgz can only parse HS256 tokens, serve user and status with the keyset aware service
+	rt.Handle("GET", "/auth/user", route.ThenFunc(tokenService.UserHandler)).
+		Summary("Get the logged in user").Tags("auth").Auth().
+		Response(http.StatusOK, "Current user", token.User{}).
+		Response(http.StatusUnauthorized, "Not logged in", map[string]string{})
+	rt.Handle("GET", "/auth/status", route.ThenFunc(tokenService.StatusHandler)).
+		Summary("Get the login status").Tags("auth").
+		Response(http.StatusOK, "Login status", map[string]string{})
+	if ssoService != nil {
+		rt.Handle("GET", "/auth/sso/login", route.ThenFunc(ssoService.Login)).
+			Summary("Start single sign-on for the organization owning the email domain").Tags("sso").
+			Query("email", "Work email used to find the organization", true).
+			Query("aud", "Audience of the session token", false).
+			Redirect(http.StatusFound, "Redirect to the identity provider")
+		rt.Handle("GET", "/auth/sso/oidc/callback", route.ThenFunc(ssoService.OIDCCallback)).
+			Summary("OpenID Connect redirect URI").Tags("sso").Hidden()
+		// signed SAML responses with certificates easily exceed the auth body limit
+		rt.Handle("POST", "/auth/sso/saml/acs", route.ThenFunc(ssoService.SAMLACS)).
+			Summary("SAML assertion consumer service").Tags("sso").Hidden()
+		rt.Handle("GET", "/auth/sso/saml/metadata", route.ThenFunc(ssoService.SAMLMetadata)).
+			Summary("SAML service provider metadata").Tags("sso").
+			Response(http.StatusOK, "SAML metadata XML", nil)
+	}
+	rt.Mount("/auth/", authRoute.Then(authMount))
+	// rate limited go-pkgz routes are registered on their own to get their limit. The login
+	// is mounted for every method, the direct provider takes credentials in a GET query too.
+	rt.Mount("/auth/local/login", authRoute.Append(loginLimit).Then(authMount))
+	rt.Document("POST", "/auth/local/login").
+		Summary("Log in with email and password, sets the session cookie").Tags("auth").
+		Query("sess", "Set to 1 for a session cookie that expires with the browser", false).
+		Request(handlers.LoginRequest{}).
+		Response(http.StatusOK, "Logged in user", token.User{}).
+		Response(http.StatusForbidden, "Incorrect user or password", map[string]string{}).
+		Problems(http.StatusTooManyRequests)
+	rt.Document("GET", "/auth/logout").
+		Summary("Log out and clear the session cookie").Tags("auth").
+		Response(http.StatusOK, "Logged out", nil)
+	if magicLinkEnabled {
+		rt.Handle("POST", "/auth/email/login", authRoute.Append(magicLinkLimit).Then(authMount)).
+			Summary("Send a single-use login link").Tags("auth").
+			Request(handlers.MagicLinkRequest{}).
+			Response(http.StatusOK, "Sent, also returned for unknown addresses", map[string]string{}).
+			Problems(http.StatusTooManyRequests)
+		rt.Document("GET", "/auth/email/login").
+			Summary("Open a login link, shows a page that confirms the login").Tags("auth").
+			Query("token", "Token from the emailed link", true).
+			Query("aud", "Audience of the session token", false).
+			Response(http.StatusOK, "Confirmation page", "")
+		// only the confirmation spends the token, so link scanners opening it don't
+		rt.Handle("POST", "/auth/email/callback", authRoute.Append(loginLimit).Then(authMount)).
+			Summary("Complete a login link").Tags("auth").
+			Form(handlers.MagicLinkConfirmForm{}).
+			Response(http.StatusOK, "Logged in user", token.User{}).
+			Response(http.StatusForbidden, "Login link is invalid or expired", map[string]string{}).
+			Problems(http.StatusTooManyRequests)
+	}
+
+	// publish public keys so other services can verify our tokens
+	rt.Handle("GET", "/.well-known/jwks.json", route.ThenFunc(tokenService.Keys.JWKSHandler)).
+		Summary("Public keys for verifying session tokens").Tags("keys").
+		Response(http.StatusOK, "JSON Web Key Set", map[string]any{})
+
+	// mount OpenID Connect provider endpoints, they follow the OIDC spec and are left out of the document
+	if oidcProvider != nil {
+		rt.Handle("GET", "/.well-known/openid-configuration", route.ThenFunc(oidcProvider.Discovery)).Hidden()
+		rt.Handle("GET", "/authorize", route.ThenFunc(oidcProvider.Authorize)).Hidden()
+		// the login form posts passwords here, it shares the budget of /auth/local/login
+		rt.Handle("POST", "/authorize", authRoute.Append(loginLimit).ThenFunc(oidcProvider.AuthorizeSubmit)).Hidden()
+		rt.Handle("POST", "/token", authRoute.ThenFunc(oidcProvider.Token)).Hidden()
+		rt.Handle("GET", "/userinfo", route.ThenFunc(oidcProvider.UserInfo)).Hidden()
+	}
+
+	// the web app gets every GET no route above matches, without the handler timeout
+	// so large assets can take as long as a slow client needs
+	if conf.Web.Enabled {
+		if fsys, source, ok := webFS(conf.Web); ok {
+			logger.L().Info().Str("source", source).Msg("Serving web app")
+			rt.Mount("GET /", web.New(fsys, web.Options{
+				ReservedPrefixes: []string{"/api/", "/auth/", "/.well-known/"},
+				LogLevel:         conf.Web.LogLevel,
+				CSP:              web.FlutterCSP(),
+			}))
+		} else {
+			logger.L().Warn().Msg("Web app enabled but no build found, run make build-web or set WEB_DIR")
+		}
+	}
 
 	addr := fmt.Sprintf("%s:%d", host, port)
-	handler := logger.Http(mainMux)
+	// the web build may be served from another origin, discovery documents and keys are public
+	cors := middleware.CORS(
+		middleware.DefaultCORSPolicy(conf.CORS.AllowedOrigins, conf.CORS.AllowCredentials, time.Duration(conf.CORS.MaxAge)*time.Second),
+		map[string]middleware.CORSPolicy{
+			"/.well-known/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}, MaxAge: time.Hour},
+		},
+	)
+
+	secure := middleware.DefaultSecurityHeaders()
+	secure.HSTSMaxAge = 0
+	if conf.Security.HSTS {
+		secure.HSTSMaxAge = time.Duration(conf.Security.HSTSMaxAge) * time.Second
+	}
+	secure.CSPReportOnly = conf.Security.CSPReportOnly
+
+	// the client address is resolved first so the access log and rate limits see the real client,
+	// recovery sits inside the access log so panics are logged with the req_id and show up as 500,
+	// compression too so the log counts the bytes that went out. Metrics go last, they label
+	// requests with the route pattern the mux sets on the request it is handed.
+	chain := middleware.New(
+		clientip.New(conf.TrustedProxies, conf.TrustedProxyHeader).Middleware,
+		logger.Http,
+		middleware.Recover,
+		middleware.SecurityHeaders(secure),
+		cors,
+		certs.RequireClientCert(conf.TLS.ClientCertPaths),
+	)
+	if conf.Compression.Enabled {
+		compress := middleware.DefaultCompressOptions()
+		compress.MinSize = conf.Compression.MinSize
+		chain = chain.Append(middleware.Compress(compress))
+	}
+	handler := chain.Append(middleware.MaxBytes(int64(conf.MaxBodyBytes)), appMetrics.Middleware).Then(mainMux)
 
-	return &http.Server{
-		Addr:    addr,
-		Handler: handler,
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(conf.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(conf.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(conf.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(conf.IdleTimeout) * time.Second,
 	}
+	return server, rt
 }
 
-func setupAuth(cfg cfg.AuthConfig, h *handlers.Handler) *authpkg.Service {
+func setupAuth(cfg cfg.AuthConfig, publicURL string, h *handlers.Handler, keys *tokens.KeySet, m mailer.Mailer) (*authpkg.Service, *tokens.Service) {
 	authOptions := authpkg.Opts{
+		// only used by go-pkgz internals, tokens are signed and verified by the keyset
 		SecretReader: token.SecretFunc(func(aud string) (string, error) {
 			return cfg.JWTSecret, nil
 		}),
@@ -132,17 +576,52 @@ func setupAuth(cfg cfg.AuthConfig, h *handlers.Handler) *authpkg.Service {
 		CookieDuration: time.Duration(cfg.CookieDuration) * time.Minute,
 		ClaimsUpd:      token.ClaimsUpdFunc(h.ClaimsUpdater()),
 		// TODO: Change the issuer based on your project
-		Issuer:      "app",
-		DisableXSRF: cfg.DisableXSRF,
+		Issuer:         "app",
+		URL:            publicURL,
+		DisableXSRF:    cfg.DisableXSRF,
+		SameSiteCookie: sameSite(cfg.CookieSameSite),
 	}
 
 	authService := authpkg.NewService(authOptions)
+	tokenService := tokens.NewService(authService.TokenService(), keys)
 
 	// add local provider with custom UserID function to use actual database UUID
-	authService.AddDirectProviderWithUserIDFunc("local",
-		provider.CredCheckerFunc(h.LocalCredChecker),
-		h.UserIDFunc(),
-	)
+	authService.AddCustomHandler(provider.DirectHandler{
+		L:            authlogger.NoOp,
+		ProviderName: "local",
+		CredChecker:  provider.CredCheckerFunc(h.LocalCredChecker),
+		TokenService: tokenService,
+		Issuer:       authOptions.Issuer,
+		UserIDFunc:   h.UserIDFunc(),
+	})
 
-	return authService
+	// add passwordless email provider, links are single-use and short-lived
+	if cfg.MagicLink.Enabled {
+		authService.AddCustomHandler(h.MagicLinkProvider("email", cfg.MagicLink, publicURL,
+			authOptions.Issuer, tokenService, m))
+	}
+
+	return authService, tokenService
+}
+
+// webFS returns the configured web build directory, or the build embedded in the binary
+func webFS(conf cfg.WebConfig) (fs.FS, string, bool) {
+	if conf.Dir != "" {
+		return os.DirFS(conf.Dir), conf.Dir, true
+	}
+	fsys, ok := web.Embedded()
+	return fsys, "embedded", ok
+}
+
+// sameSite maps the configured cookie SameSite mode to its http value
+func sameSite(mode cfg.CookieSameSite) http.SameSite {
+	switch mode {
+	case cfg.CookieSameSiteLax:
+		return http.SameSiteLaxMode
+	case cfg.CookieSameSiteStrict:
+		return http.SameSiteStrictMode
+	case cfg.CookieSameSiteNone:
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteDefaultMode
 }
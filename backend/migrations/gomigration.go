@@ -0,0 +1,237 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// GoMigration is a migration written in Go, for data changes SQL expresses badly like
+// re-hashing values or splitting columns. Its version is numbered together with the SQL files
+// of its source and recorded in the same version table. Set exactly one of Up and Batch.
+//
+// Go migrations only run forward: rolling back past one just moves the version, data
+// changes are not undone.
+type GoMigration struct {
+	Version uint
+	Name    string // lowercase letters, digits and underscores, like the SQL file names
+
+	// Up runs in a transaction that also records the version, so the migration applies
+	// completely or not at all
+	Up func(ctx context.Context, tx pgx.Tx) error
+
+	// Batch is for backfills too large for one transaction. It processes the batch after
+	// cursor, "" for the first one, and returns the cursor to continue from, "" when done.
+	// Every batch commits in its own transaction together with the returned cursor, so an
+	// interrupted backfill resumes after the last committed batch on the next run.
+	Batch func(ctx context.Context, tx pgx.Tx, cursor string) (next string, err error)
+}
+
+// progressTable keeps the cursor of unfinished batched migrations
+const progressTable = "schema_migrations_progress"
+
+var (
+	goMu         sync.Mutex
+	goMigrations []GoMigration
+	validName    = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Register adds a Go migration to the core migrations, call it from an init func. Its version
+// must not be used by a file in postgres/.
+func Register(m GoMigration) {
+	if err := m.validate(); err != nil {
+		panic(err)
+	}
+	goMu.Lock()
+	defer goMu.Unlock()
+	for _, existing := range goMigrations {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migrations: Go migration %d registered twice", m.Version))
+		}
+	}
+	goMigrations = append(goMigrations, m)
+}
+
+func registered() []GoMigration {
+	goMu.Lock()
+	defer goMu.Unlock()
+	return slices.Clone(goMigrations)
+}
+
+func (m GoMigration) validate() error {
+	switch {
+	case m.Version == 0:
+		return errors.New("migrations: Go migration without a version")
+	case !validName.MatchString(m.Name):
+		return fmt.Errorf("migrations: Go migration %d has an invalid name %q", m.Version, m.Name)
+	case (m.Up == nil) == (m.Batch == nil):
+		return fmt.Errorf("migrations: Go migration %d must set exactly one of Up and Batch", m.Version)
+	}
+	return nil
+}
+
+// runGo applies m and records its version in table
+func runGo(ctx context.Context, pool *pgxpool.Pool, l zerolog.Logger, table string, m GoMigration) error {
+	l = l.With().Uint("version", m.Version).Str("migration", m.Name).Logger()
+	start := time.Now()
+	if m.Up != nil {
+		err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			if err := m.Up(ctx, tx); err != nil {
+				return err
+			}
+			return setVersion(ctx, tx, table, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("go migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		l.Info().Dur("duration", time.Since(start)).Msg("Go migration applied")
+		return nil
+	}
+
+	if _, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+progressTable+` (
+		version_table TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		cursor TEXT NOT NULL,
+		batches BIGINT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (version_table, version)
+	)`); err != nil {
+		return fmt.Errorf("create migration progress table: %w", err)
+	}
+
+	for first, done := true, false; !done; first = false {
+		err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			cursor, batches := "", int64(0)
+			err := tx.QueryRow(ctx, `SELECT cursor, batches FROM `+progressTable+`
+				WHERE version_table = $1 AND version = $2 FOR UPDATE`, table, m.Version).Scan(&cursor, &batches)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("read progress: %w", err)
+			}
+			if first && batches == 0 {
+				l.Info().Msg("Starting batched Go migration")
+			} else if first {
+				l.Info().Int64("batches", batches).Str("cursor", cursor).Msg("Resuming batched Go migration")
+			}
+
+			next, err := m.Batch(ctx, tx, cursor)
+			if err != nil {
+				return fmt.Errorf("batch after %q: %w", cursor, err)
+			}
+			batches++
+			if next == "" {
+				done = true
+				l.Info().Int64("batches", batches).Dur("duration", time.Since(start)).Msg("Go migration applied")
+				if _, err := tx.Exec(ctx, `DELETE FROM `+progressTable+` WHERE version_table = $1 AND version = $2`,
+					table, m.Version); err != nil {
+					return fmt.Errorf("clear progress: %w", err)
+				}
+				return setVersion(ctx, tx, table, m.Version)
+			}
+			if next == cursor {
+				return fmt.Errorf("batch after %q returned the same cursor, it would never finish", cursor)
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO `+progressTable+` (version_table, version, cursor, batches)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (version_table, version) DO UPDATE
+				SET cursor = EXCLUDED.cursor, batches = EXCLUDED.batches, updated_at = NOW()`,
+				table, m.Version, next, batches)
+			if err != nil {
+				return fmt.Errorf("save progress: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("go migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// setVersion records version the way golang-migrate does, so both agree on the state
+func setVersion(ctx context.Context, tx pgx.Tx, table string, version uint) error {
+	ident := pgx.Identifier{table}.Sanitize()
+	if _, err := tx.Exec(ctx, "TRUNCATE "+ident); err != nil {
+		return fmt.Errorf("set version: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO "+ident+" (version, dirty) VALUES ($1, false)", int64(version)); err != nil {
+		return fmt.Errorf("set version: %w", err)
+	}
+	return nil
+}
+
+// goSource adds the Go migrations to the SQL files golang-migrate reads, so it can step over
+// their versions. It never runs them: up stops short of every Go migration, which runGo
+// applies. Rolling back past one reads no down file, which only moves the version.
+type goSource struct {
+	source.Driver
+	versions []uint // SQL and Go, ascending
+	code     map[uint]GoMigration
+}
+
+func newGoSource(sql source.Driver, src Source) (*goSource, error) {
+	list, err := src.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	s := &goSource{Driver: sql, code: map[uint]GoMigration{}}
+	for _, m := range list {
+		s.versions = append(s.versions, m.Version)
+		if m.code != nil {
+			s.code[m.Version] = *m.code
+		}
+	}
+	return s, nil
+}
+
+func (s *goSource) First() (uint, error) {
+	if len(s.versions) == 0 {
+		return 0, &os.PathError{Op: "first", Err: os.ErrNotExist}
+	}
+	return s.versions[0], nil
+}
+
+func (s *goSource) Prev(version uint) (uint, error) {
+	i, ok := slices.BinarySearch(s.versions, version)
+	if !ok || i == 0 {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %d", version), Err: os.ErrNotExist}
+	}
+	return s.versions[i-1], nil
+}
+
+func (s *goSource) Next(version uint) (uint, error) {
+	i, ok := slices.BinarySearch(s.versions, version)
+	if !ok || i == len(s.versions)-1 {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %d", version), Err: os.ErrNotExist}
+	}
+	return s.versions[i+1], nil
+}
+
+func (s *goSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if m, ok := s.code[version]; ok {
+		// fails loudly should golang-migrate ever be asked to apply it, instead of recording
+		// the version without running the code
+		sql := fmt.Sprintf(`DO $$ BEGIN RAISE EXCEPTION 'migration %d_%s is written in Go, apply it with migrations.Run'; END $$;`,
+			version, m.Name)
+		return io.NopCloser(strings.NewReader(sql)), m.Name, nil
+	}
+	return s.Driver.ReadUp(version)
+}
+
+func (s *goSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if _, ok := s.code[version]; ok {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read down for version %d", version), Err: os.ErrNotExist}
+	}
+	return s.Driver.ReadDown(version)
+}
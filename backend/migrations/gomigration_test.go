@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+)
+
+func noop(context.Context, pgx.Tx) error { return nil }
+
+func goTestSource() Source {
+	src := testSource()
+	src.Go = []GoMigration{
+		{Version: 3, Name: "split_names", Up: noop},
+		{Version: 11, Name: "backfill", Batch: func(context.Context, pgx.Tx, string) (string, error) { return "", nil }},
+	}
+	return src
+}
+
+func TestGoMigrationValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       GoMigration
+		wantErr bool
+	}{
+		{"up", GoMigration{Version: 1, Name: "split_names", Up: noop}, false},
+		{"no version", GoMigration{Name: "split_names", Up: noop}, true},
+		{"bad name", GoMigration{Version: 1, Name: "Split Names", Up: noop}, true},
+		{"no func", GoMigration{Version: 1, Name: "split_names"}, true},
+		{"both funcs", GoMigration{Version: 1, Name: "split_names", Up: noop,
+			Batch: func(context.Context, pgx.Tx, string) (string, error) { return "", nil }}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.m.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrationsWithGo(t *testing.T) {
+	list, err := goTestSource().Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []uint
+	for _, m := range list {
+		versions = append(versions, m.Version)
+	}
+	if want := []uint{1, 2, 3, 10, 11}; !slices.Equal(versions, want) {
+		t.Errorf("versions = %v, want %v", versions, want)
+	}
+	if !list[2].IsGo() || list[1].IsGo() {
+		t.Error("IsGo() doesn't tell Go migrations from files")
+	}
+
+	steps, err := goTestSource().Plan(2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].File() != "0003_split_names (Go)" {
+		t.Errorf("Plan(2, 10) = %+v, want the Go migration then widgets", steps)
+	}
+
+	src := goTestSource()
+	src.Go = append(src.Go, GoMigration{Version: 2, Name: "clash", Up: noop})
+	if _, err := src.Migrations(); err == nil {
+		t.Error("a Go migration reusing a file version was accepted")
+	}
+}
+
+func TestGoSource(t *testing.T) {
+	src := goTestSource()
+	sql, err := iofs.New(src.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newGoSource(sql, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.First(); err != nil || v != 1 {
+		t.Errorf("First() = %d, %v, want 1", v, err)
+	}
+	if v, err := s.Next(2); err != nil || v != 3 {
+		t.Errorf("Next(2) = %d, %v, want the Go migration 3", v, err)
+	}
+	if v, err := s.Next(3); err != nil || v != 10 {
+		t.Errorf("Next(3) = %d, %v, want 10", v, err)
+	}
+	if v, err := s.Prev(10); err != nil || v != 3 {
+		t.Errorf("Prev(10) = %d, %v, want 3", v, err)
+	}
+	if _, err := s.Next(11); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Next(11) error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.Prev(1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Prev(1) error = %v, want ErrNotExist", err)
+	}
+
+	// golang-migrate must never record a Go migration as applied without running it
+	r, _, err := s.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(r)
+	if !strings.Contains(string(body), "RAISE EXCEPTION") {
+		t.Errorf("ReadUp(3) = %q, want SQL that fails", body)
+	}
+	if _, _, err := s.ReadDown(3); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadDown(3) error = %v, want ErrNotExist so only the version moves", err)
+	}
+	if r, _, err := s.ReadUp(10); err != nil {
+		t.Errorf("ReadUp(10) error = %v", err)
+	} else {
+		r.Close()
+	}
+}
+
+func TestGoOnlySource(t *testing.T) {
+	src := Source{FS: fstest.MapFS{}, Go: []GoMigration{{Version: 1, Name: "seed", Up: noop}}}
+	if v, err := src.Latest(); err != nil || v != 1 {
+		t.Errorf("Latest() = %d, %v, want 1", v, err)
+	}
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// lockKey is the advisory lock every instance takes before migrating, it only has to be the
+// same across instances and not collide with other advisory locks on the database
+const lockKey int64 = 0x6170706d69677261 // "appmigra"
+
+// lockPollInterval is how often an instance waiting for the lock tries again
+const lockPollInterval = time.Second
+
+// Outcome is how RunLocked ended on this instance
+type Outcome struct {
+	Leader bool          // this instance applied the pending migrations
+	Waited time.Duration // time spent waiting for another instance holding the lock
+}
+
+func (o Outcome) String() string {
+	switch {
+	case o.Leader && o.Waited > 0:
+		return fmt.Sprintf("applied pending migrations after waiting %s for the lock", o.Waited.Round(time.Millisecond))
+	case o.Leader:
+		return "applied pending migrations"
+	case o.Waited > 0:
+		return fmt.Sprintf("another instance migrated, waited %s for it", o.Waited.Round(time.Millisecond))
+	default:
+		return "up to date"
+	}
+}
+
+// RunLocked applies the pending migrations of sources in order while holding a Postgres
+// advisory lock, so of several instances starting at once only the first one migrates. The
+// others wait up to wait for the lock, then find the target versions reached and return
+// without running anything. If the leader died or failed the next instance to get the lock
+// takes over. golang-migrate's own lock only covers one source at a time and doesn't wait.
+func RunLocked(ctx context.Context, pool *pgxpool.Pool, logger *zerolog.Logger, sources []Source, wait time.Duration) (Outcome, error) {
+	l := logger.With().Str("component", "migrations").Logger()
+	start := time.Now()
+
+	release, contended, err := lock(ctx, pool, l, wait)
+	if err != nil {
+		if contended && ctx.Err() == nil {
+			return Outcome{Waited: time.Since(start)}, err
+		}
+		return Outcome{}, err
+	}
+	defer release()
+
+	outcome := Outcome{}
+	if contended {
+		outcome.Waited = time.Since(start)
+	}
+	for _, src := range sources {
+		if CheckApplied(ctx, pool, src) == nil {
+			continue
+		}
+		outcome.Leader = true
+		if err := Run(ctx, pool, logger, src); err != nil {
+			return outcome, fmt.Errorf("%s: %w", src.Name, err)
+		}
+	}
+	l.Info().Bool("leader", outcome.Leader).Dur("waited", outcome.Waited).Str("outcome", outcome.String()).Msg("Migrations finished")
+	return outcome, nil
+}
+
+// withLock runs fn while holding the lock RunLocked takes, waiting up to wait for it, so
+// rolling back or forcing a version never races instances migrating on startup
+func withLock(ctx context.Context, pool *pgxpool.Pool, l zerolog.Logger, wait time.Duration, fn func() error) error {
+	release, _, err := lock(ctx, pool, l, wait)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// lock takes the migration lock, waiting up to wait while another instance holds it.
+// contended reports whether it had to wait.
+func lock(ctx context.Context, pool *pgxpool.Pool, l zerolog.Logger, wait time.Duration) (release func(), contended bool, err error) {
+	// session locks belong to a connection, keep one until the lock is released. It also goes
+	// away with the connection if the process dies while holding it.
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("acquire connection for the migration lock: %w", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	for {
+		var locked bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked); err != nil {
+			conn.Release()
+			return nil, contended, fmt.Errorf("take migration lock: %w", err)
+		}
+		if locked {
+			break
+		}
+		if !contended {
+			l.Info().Dur("wait", wait).Msg("Another instance is migrating, waiting for it")
+			contended = true
+		}
+		select {
+		case <-waitCtx.Done():
+			conn.Release()
+			if err := ctx.Err(); err != nil {
+				return nil, contended, err
+			}
+			return nil, contended, fmt.Errorf("migration lock still held by another instance after %s", wait)
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	release = func() {
+		defer conn.Release()
+		if _, err := conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			// closing the connection releases the lock as well
+			l.Warn().Err(err).Msg("Failed to release migration lock")
+			_ = conn.Conn().Close(context.WithoutCancel(ctx))
+		}
+	}
+	return release, contended, nil
+}
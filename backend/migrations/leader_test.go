@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutcomeString(t *testing.T) {
+	tests := []struct {
+		outcome Outcome
+		want    string
+	}{
+		{Outcome{}, "up to date"},
+		{Outcome{Leader: true}, "applied pending migrations"},
+		{Outcome{Leader: true, Waited: 1500 * time.Millisecond}, "applied pending migrations after waiting 1.5s for the lock"},
+		{Outcome{Waited: 3 * time.Second}, "another instance migrated, waited 3s for it"},
+	}
+	for _, tt := range tests {
+		if got := tt.outcome.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.outcome, got, tt.want)
+		}
+	}
+}
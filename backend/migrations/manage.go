@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Version returns the applied version of src, 0 when nothing is applied yet
+func Version(pool *pgxpool.Pool, src Source) (version uint, dirty bool, err error) {
+	m, closeFn, err := open(pool, src)
+	if err != nil {
+		return 0, false, err
+	}
+	defer closeFn()
+	return currentVersion(m)
+}
+
+// currentVersion returns the version m is at, 0 when nothing is applied yet
+func currentVersion(m *migrate.Migrate) (version uint, dirty bool, err error) {
+	version, dirty, err = m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Steps applies n pending migrations, or rolls back -n applied ones when n is negative. It
+// holds the migration lock, waiting up to wait for another instance to release it.
+func Steps(ctx context.Context, pool *pgxpool.Pool, src Source, n int, wait time.Duration) error {
+	l := sourceLogger(src)
+	return withLock(ctx, pool, l, wait, func() error {
+		m, closeFn, err := open(pool, src)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if n > 0 {
+			// Go migrations on the way only run through up
+			current, _, err := currentVersion(m)
+			if err != nil {
+				return err
+			}
+			target, err := src.Target(current, n)
+			if err != nil {
+				return err
+			}
+			err = up(ctx, m, pool, l, src, target)
+		} else {
+			err = m.Steps(n)
+		}
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migrate %d steps: %w", n, err)
+		}
+		return nil
+	})
+}
+
+// Migrate moves to version, applying or rolling back whatever is in between. It holds the
+// migration lock like Steps.
+func Migrate(ctx context.Context, pool *pgxpool.Pool, src Source, version uint, wait time.Duration) error {
+	l := sourceLogger(src)
+	return withLock(ctx, pool, l, wait, func() error {
+		m, closeFn, err := open(pool, src)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		current, _, err := currentVersion(m)
+		if err != nil {
+			return err
+		}
+		if version > current {
+			err = up(ctx, m, pool, l, src, version)
+		} else {
+			err = m.Migrate(version)
+		}
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migrate to version %d: %w", version, err)
+		}
+		return nil
+	})
+}
+
+// Down rolls back every applied migration of src. It holds the migration lock like Steps.
+func Down(ctx context.Context, pool *pgxpool.Pool, src Source, wait time.Duration) error {
+	return withLock(ctx, pool, sourceLogger(src), wait, func() error {
+		m, closeFn, err := open(pool, src)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("roll back migrations: %w", err)
+		}
+		return nil
+	})
+}
+
+// Force sets the version without running migrations and clears the dirty flag, for
+// recovering after a failed migration was fixed by hand. -1 means no version. It holds the
+// migration lock like Steps.
+func Force(ctx context.Context, pool *pgxpool.Pool, src Source, version int, wait time.Duration) error {
+	return withLock(ctx, pool, sourceLogger(src), wait, func() error {
+		m, closeFn, err := open(pool, src)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if err := m.Force(version); err != nil {
+			return fmt.Errorf("force version %d: %w", version, err)
+		}
+		return nil
+	})
+}
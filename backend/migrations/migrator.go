@@ -3,11 +3,14 @@ package migrations
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
@@ -18,61 +21,67 @@ import (
 //go:embed postgres/*.sql
 var PgMigrations embed.FS
 
+// Source is a set of migrations with its own version table, so feature modules can version
+// their schema independently of the core tables
+type Source struct {
+	Name  string        // shown in logs
+	FS    fs.FS         // NNNN_name.up.sql and NNNN_name.down.sql files at the root
+	Table string        // golang-migrate version table
+	Go    []GoMigration // numbered together with the files in FS
+}
+
+// Core is the source of the embedded PgMigrations and the registered Go migrations
+func Core() Source {
+	sub, err := fs.Sub(PgMigrations, "postgres")
+	if err != nil {
+		panic(err) // the directory is embedded, it can't be missing
+	}
+	return Source{Name: "core", FS: sub, Table: "schema_migrations", Go: registered()}
+}
+
 func RunMigrations(ctx context.Context, pool *pgxpool.Pool, logger *zerolog.Logger) error {
+	return Run(ctx, pool, logger, Core())
+}
+
+// Run applies the pending migrations of src
+func Run(ctx context.Context, pool *pgxpool.Pool, logger *zerolog.Logger, src Source) error {
 	if logger == nil {
 		return fmt.Errorf("logger is nil")
 	}
 
-	l := log.With().Str("component", "migrations").Logger()
+	l := sourceLogger(src)
 	start := time.Now()
 	l.Info().Msg("running database migrations")
 
-	// Create source driver from embedded filesystem
-	source, err := iofs.New(PgMigrations, "postgres")
-	if err != nil {
-		return fmt.Errorf("create migration source: %w", err)
-	}
-	defer func() { _ = source.Close() }()
-
-	// Convert pgxpool to sql.Db for golang-migrate
-	sqlDB := stdlib.OpenDBFromPool(pool)
-	defer sqlDB.Close()
-
-	// Create postgres database driver for migrate
-	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
-	if err != nil {
-		return fmt.Errorf("create postgres driver: %w", err)
-	}
-
-	// Create migrate instance
-	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	m, closeFn, err := open(pool, src)
 	if err != nil {
-		return fmt.Errorf("create migrate instance: %w", err)
+		return err
 	}
-	defer func() {
-		_, _ = m.Close()
-	}()
+	defer closeFn()
 
 	// Log current version
 	if v, dirty, err := m.Version(); err == nil {
 		if dirty {
-			return fmt.Errorf("database is dirty at version %d", v)
+			return fmt.Errorf("database is dirty at version %d, fix the failed migration and force the version it left the schema in", v)
 		}
 		l.Info().Uint("version", v).Msg("current migration version")
-	} else if err == migrate.ErrNilVersion {
+	} else if errors.Is(err, migrate.ErrNilVersion) {
 		l.Info().Msg("no existing migrations applied yet")
 	} else {
 		return fmt.Errorf("read current migration version: %w", err)
 	}
 
 	// Run migrations
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("apply migrations: %w", err)
+	latest, err := src.Latest()
+	if err != nil {
+		return err
 	}
-
-	if err == migrate.ErrNoChange {
-		l.Info().Dur("duration", time.Since(start)).Msg("migrations up-to-date")
-		return nil
+	if err := up(ctx, m, pool, l, src, latest); err != nil {
+		if errors.Is(err, migrate.ErrNoChange) {
+			l.Info().Dur("duration", time.Since(start)).Msg("migrations up-to-date")
+			return nil
+		}
+		return fmt.Errorf("apply migrations: %w", err)
 	}
 
 	// Log final version
@@ -90,3 +99,103 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool, logger *zerolog.Logg
 	l.Info().Dur("duration", time.Since(start)).Msg("migrations applied successfully")
 	return nil
 }
+
+// sourceLogger is the log context of the migrations of src
+func sourceLogger(src Source) zerolog.Logger {
+	return log.With().Str("component", "migrations").Str("source", src.Name).Logger()
+}
+
+// up applies the pending migrations up to version target. golang-migrate runs the SQL files
+// and is stopped short of every Go migration, which runGo applies. Returns ErrNoChange when
+// nothing was pending.
+func up(ctx context.Context, m *migrate.Migrate, pool *pgxpool.Pool, l zerolog.Logger, src Source, target uint) error {
+	current, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		current, err = 0, nil
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return migrate.ErrDirty{Version: int(current)}
+	}
+	list, err := src.Migrations()
+	if err != nil {
+		return err
+	}
+
+	applied := false
+	var sqlTarget uint // the last pending SQL file before the next Go migration
+	flush := func() error {
+		if sqlTarget <= current {
+			return nil
+		}
+		if err := m.Migrate(sqlTarget); err != nil {
+			return err
+		}
+		current, applied = sqlTarget, true
+		return nil
+	}
+	for _, mig := range list {
+		if mig.Version <= current || mig.Version > target {
+			continue
+		}
+		if mig.code == nil {
+			sqlTarget = mig.Version
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := runGo(ctx, pool, l, src.Table, *mig.code); err != nil {
+			return err
+		}
+		current, applied = mig.Version, true
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if !applied {
+		return migrate.ErrNoChange
+	}
+	return nil
+}
+
+// open creates a migrate instance for src, call the returned func to release it
+func open(pool *pgxpool.Pool, src Source) (*migrate.Migrate, func(), error) {
+	// Create source driver from embedded filesystem
+	var sourceDrv source.Driver
+	sourceDrv, err := iofs.New(src.FS, ".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create migration source: %w", err)
+	}
+	if len(src.Go) > 0 {
+		withGo, err := newGoSource(sourceDrv, src)
+		if err != nil {
+			_ = sourceDrv.Close()
+			return nil, nil, fmt.Errorf("create migration source: %w", err)
+		}
+		sourceDrv = withGo
+	}
+
+	// Convert pgxpool to sql.Db for golang-migrate
+	sqlDB := stdlib.OpenDBFromPool(pool)
+
+	// Create postgres database driver for migrate
+	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{MigrationsTable: src.Table})
+	if err != nil {
+		_ = sourceDrv.Close()
+		_ = sqlDB.Close()
+		return nil, nil, fmt.Errorf("create postgres driver: %w", err)
+	}
+
+	// Create migrate instance
+	m, err := migrate.NewWithInstance("go", sourceDrv, "postgres", driver)
+	if err != nil {
+		_ = sourceDrv.Close()
+		_ = sqlDB.Close()
+		return nil, nil, fmt.Errorf("create migrate instance: %w", err)
+	}
+	// closes the source and the driver, which closes sqlDB
+	return m, func() { _, _ = m.Close() }, nil
+}
@@ -0,0 +1,151 @@
+package migrations
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Migration is one version of a source
+type Migration struct {
+	Version uint
+	Name    string // the part of the file name between the version and the direction
+	up      string
+	down    string
+	code    *GoMigration // set for Go migrations, which have no files
+}
+
+// IsGo reports whether the migration is written in Go
+func (m Migration) IsGo() bool {
+	return m.code != nil
+}
+
+// Step is a migration file that moving between versions runs
+type Step struct {
+	Migration
+	Direction source.Direction
+	SQL       string
+}
+
+// File is the name of the file the step runs
+func (s Step) File() string {
+	if s.code != nil {
+		return fmt.Sprintf("%04d_%s (Go)", s.Version, s.Name)
+	}
+	if s.Direction == source.Down {
+		return s.down
+	}
+	return s.up
+}
+
+// Migrations returns the migrations of src ordered by version
+func (src Source) Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(src.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		// the same parser golang-migrate uses, it skips other files too
+		parsed, err := source.Parse(e.Name())
+		if err != nil {
+			continue
+		}
+		v := uint(parsed.Version)
+		m, ok := byVersion[v]
+		if !ok {
+			m = &Migration{Version: v, Name: parsed.Identifier}
+			byVersion[v] = m
+		}
+		if parsed.Direction == source.Down {
+			m.down = e.Name()
+		} else {
+			m.up = e.Name()
+		}
+	}
+
+	for _, g := range src.Go {
+		if _, ok := byVersion[g.Version]; ok {
+			return nil, fmt.Errorf("migration %d is both a file and a Go migration", g.Version)
+		}
+		byVersion[g.Version] = &Migration{Version: g.Version, Name: g.Name, code: &g}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		list = append(list, *m)
+	}
+	slices.SortFunc(list, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return list, nil
+}
+
+// Target returns the version n steps away from version from, negative n steps down. Stepping
+// past the first migration returns 0, no version.
+func (src Source) Target(from uint, n int) (uint, error) {
+	list, err := src.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	i := slices.IndexFunc(list, func(m Migration) bool { return m.Version > from }) // first pending
+	if i < 0 {
+		i = len(list)
+	}
+	switch j := i - 1 + n; {
+	case j < 0:
+		return 0, nil
+	case j >= len(list):
+		return 0, fmt.Errorf("only %d pending migrations", len(list)-i)
+	default:
+		return list[j].Version, nil
+	}
+}
+
+// Plan returns the steps that move the database from version from to version to with their
+// SQL, in the order they run, without touching the database. It is what a dry run prints, Go
+// migrations show up without SQL.
+func (src Source) Plan(from, to uint) ([]Step, error) {
+	list, err := src.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	if to >= from {
+		for _, m := range list {
+			if m.Version > from && m.Version <= to {
+				steps = append(steps, Step{Migration: m, Direction: source.Up})
+			}
+		}
+	} else {
+		for _, m := range slices.Backward(list) {
+			if m.Version > to && m.Version <= from {
+				steps = append(steps, Step{Migration: m, Direction: source.Down})
+			}
+		}
+	}
+
+	for i := range steps {
+		if steps[i].code != nil {
+			steps[i].SQL = "-- runs in Go"
+			if steps[i].Direction == source.Down {
+				steps[i].SQL = "-- Go migrations are not rolled back, only the version changes"
+			}
+			continue
+		}
+		file := steps[i].File()
+		if file == "" {
+			return nil, fmt.Errorf("migration %d has no %s file", steps[i].Version, steps[i].Direction)
+		}
+		sql, err := fs.ReadFile(src.FS, file)
+		if err != nil {
+			return nil, err
+		}
+		steps[i].SQL = string(sql)
+	}
+	return steps, nil
+}
@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func testSource() Source {
+	return Source{Name: "test", Table: "schema_migrations_test", FS: fstest.MapFS{
+		"0001_users.up.sql":     {Data: []byte("CREATE TABLE users ();")},
+		"0001_users.down.sql":   {Data: []byte("DROP TABLE users;")},
+		"0002_orgs.up.sql":      {Data: []byte("CREATE TABLE orgs ();")},
+		"0002_orgs.down.sql":    {Data: []byte("DROP TABLE orgs;")},
+		"0010_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets ();")},
+		"0010_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"README.md":             {Data: []byte("not a migration")},
+	}}
+}
+
+func TestMigrations(t *testing.T) {
+	list, err := testSource().Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range list {
+		got = append(got, m.Name)
+	}
+	if want := []string{"users", "orgs", "widgets"}; !slices.Equal(got, want) {
+		t.Errorf("Migrations() = %v, want %v", got, want)
+	}
+
+	latest, err := testSource().Latest()
+	if err != nil || latest != 10 {
+		t.Errorf("Latest() = %d, %v, want 10", latest, err)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    uint
+		n       int
+		want    uint
+		wantErr bool
+	}{
+		{"one up from nothing", 0, 1, 1, false},
+		{"two up", 1, 2, 10, false},
+		{"one down", 10, -1, 2, false},
+		{"down past the first", 2, -5, 0, false},
+		{"down from a version between files", 5, -1, 1, false},
+		{"more than pending", 2, 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testSource().Target(tt.from, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Target() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Target() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to uint
+		want     []string
+	}{
+		{"up from nothing", 0, 10, []string{"0001_users.up.sql", "0002_orgs.up.sql", "0010_widgets.up.sql"}},
+		{"up partially", 1, 2, []string{"0002_orgs.up.sql"}},
+		{"down in reverse", 10, 1, []string{"0010_widgets.down.sql", "0002_orgs.down.sql"}},
+		{"down to nothing", 2, 0, []string{"0002_orgs.down.sql", "0001_users.down.sql"}},
+		{"nothing to do", 10, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := testSource().Plan(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range steps {
+				got = append(got, s.File())
+				if s.SQL == "" {
+					t.Errorf("%s has no SQL", s.File())
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Plan(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+
+	steps, err := testSource().Plan(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[0].Direction != source.Down || steps[0].SQL != "DROP TABLE orgs;" {
+		t.Errorf("Plan(2, 1) = %+v, want the down SQL of orgs", steps[0])
+	}
+}
+
+func TestPlanMissingDownFile(t *testing.T) {
+	src := Source{FS: fstest.MapFS{"0001_users.up.sql": {Data: []byte("CREATE TABLE users ();")}}}
+	if _, err := src.Plan(1, 0); err == nil {
+		t.Error("Plan() rolling back a migration without a down file succeeded")
+	}
+}
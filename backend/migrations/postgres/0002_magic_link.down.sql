@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_login_tokens_email;
+DROP TABLE IF EXISTS login_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
+-- NOTE: postgres cannot drop a value from an enum, 'email' stays in auth_provider.
+-- The up migration uses ADD VALUE IF NOT EXISTS so it can be re-applied safely.
@@ -0,0 +1,18 @@
+-- passwordless (magic link) users
+ALTER TYPE auth_provider ADD VALUE IF NOT EXISTS 'email';
+
+-- email verification flag, set once a user proves ownership of the address
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- single-use login tokens sent by email, only the sha256 of the token is stored
+CREATE TABLE login_tokens (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(254) NOT NULL,
+    token_hash text UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ, -- null until the token is consumed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- index on email for invalidating outstanding tokens
+CREATE INDEX idx_login_tokens_email ON login_tokens(email);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_oauth_codes_expires_at;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,41 @@
+-- OAuth2/OIDC clients allowed to use this backend as their identity provider.
+-- Register a client with e.g.
+--   INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris)
+--   VALUES ('wiki', 'Internal Wiki', encode(digest('<secret>', 'sha256'), 'hex'), '{https://wiki.example.com/callback}');
+-- Leave secret_hash NULL for public clients (SPAs, native apps), they must use PKCE.
+CREATE TABLE oauth_clients (
+    id VARCHAR(255) PRIMARY KEY, -- client_id
+    name VARCHAR(255) NOT NULL,
+    secret_hash text, -- hex sha256 of the client secret, null for public clients
+    redirect_uris text[] NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{openid,profile,email}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- scopes a user agreed to share with a client
+CREATE TABLE oauth_consents (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes text[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- short lived single-use authorization codes, only the sha256 of the code is stored
+CREATE TABLE oauth_codes (
+    code_hash text PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri text NOT NULL,
+    scopes text[] NOT NULL,
+    nonce text NOT NULL DEFAULT '',
+    code_challenge text NOT NULL,
+    auth_time TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_oauth_codes_expires_at ON oauth_codes(expires_at);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_sso_login_states_expires_at;
+DROP TABLE IF EXISTS sso_login_states;
+DROP TABLE IF EXISTS sso_domains;
+DROP TABLE IF EXISTS sso_connections;
+DROP TYPE IF EXISTS sso_protocol;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
+-- NOTE: postgres cannot drop a value from an enum, 'sso' stays in auth_provider.
@@ -0,0 +1,59 @@
+-- users provisioned on first enterprise single sign-on
+ALTER TYPE auth_provider ADD VALUE IF NOT EXISTS 'sso';
+
+-- tenants with their own identity provider
+CREATE TABLE organizations (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- organization the user belongs to, set on the first sso login
+ALTER TABLE users ADD COLUMN organization_id uuid REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE TYPE sso_protocol AS ENUM ('oidc', 'saml');
+
+-- identity provider of an organization, one per organization.
+-- Register an Okta/Azure AD tenant with e.g.
+--   INSERT INTO organizations (name) VALUES ('Acme') RETURNING id;
+--   INSERT INTO sso_connections (organization_id, protocol, oidc_issuer, oidc_client_id, oidc_client_secret)
+--   VALUES ('<org id>', 'oidc', 'https://acme.okta.com', '<client id>', '<client secret>');
+--   INSERT INTO sso_domains (domain, organization_id) VALUES ('acme.com', '<org id>');
+-- For SAML set protocol 'saml' and saml_idp_metadata to the IdP metadata XML instead.
+CREATE TABLE sso_connections (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id uuid UNIQUE NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    protocol sso_protocol NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    oidc_issuer text, -- issuer or discovery URL
+    oidc_client_id text,
+    oidc_client_secret text,
+    saml_idp_metadata text, -- IdP metadata XML
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (protocol <> 'oidc' OR (oidc_issuer IS NOT NULL AND oidc_client_id IS NOT NULL)),
+    CHECK (protocol <> 'saml' OR saml_idp_metadata IS NOT NULL)
+);
+
+-- email domains routed to an organization's identity provider, stored lowercase
+CREATE TABLE sso_domains (
+    domain VARCHAR(253) PRIMARY KEY,
+    organization_id uuid NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- pending sso logins keyed by the sha256 of the OIDC state or SAML RelayState
+CREATE TABLE sso_login_states (
+    state_hash text PRIMARY KEY,
+    connection_id uuid NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+    nonce text NOT NULL DEFAULT '',
+    code_verifier text NOT NULL DEFAULT '', -- PKCE verifier for the IdP
+    request_id text NOT NULL DEFAULT '', -- SAML AuthnRequest ID
+    audience text NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_sso_login_states_expires_at ON sso_login_states(expires_at);
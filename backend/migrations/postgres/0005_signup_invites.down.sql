@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_signup_invites_email;
+DROP TABLE IF EXISTS signup_invites;
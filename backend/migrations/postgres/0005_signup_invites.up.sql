@@ -0,0 +1,15 @@
+-- invites for SIGNUP_MODE=invite, only the sha256 of the invite token is stored.
+-- Invite someone with e.g.
+--   INSERT INTO signup_invites (email, token_hash, expires_at)
+--   VALUES ('new.user@example.com', encode(digest('<token>', 'sha256'), 'hex'), NOW() + INTERVAL '7 days');
+-- and send them the token. Providers that verify the email (magic link) accept the invite without the token.
+CREATE TABLE signup_invites (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(254) NOT NULL,
+    token_hash text UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ, -- null until an account is created with the invite
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_signup_invites_email ON signup_invites(email);
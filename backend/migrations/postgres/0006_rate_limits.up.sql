@@ -0,0 +1,12 @@
+-- rate limit counters shared by all replicas, see internal/ratelimit.
+-- Losing them on a crash only resets the limits, so the table skips the WAL.
+CREATE UNLOGGED TABLE rate_limits (
+    key text PRIMARY KEY,
+    value double precision NOT NULL DEFAULT 0,
+    prev double precision NOT NULL DEFAULT 0,
+    at TIMESTAMPTZ, -- null for a key that was just created
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- index on expires_at for deleting idle keys
+CREATE INDEX idx_rate_limits_expires_at ON rate_limits(expires_at);
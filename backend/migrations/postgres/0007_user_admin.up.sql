@@ -0,0 +1,2 @@
+-- admins are granted from the command line: api user grant-admin -email ...
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
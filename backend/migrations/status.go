@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Latest returns the highest version in src
+func (src Source) Latest() (uint, error) {
+	list, err := src.Migrations()
+	if err != nil || len(list) == 0 {
+		return 0, err
+	}
+	return list[len(list)-1].Version, nil
+}
+
+// Report lists the migrations of a source and which of them are applied
+type Report struct {
+	Source  string
+	Table   string
+	Version uint // 0 when nothing is applied
+	Dirty   bool // the migration at Version failed halfway, see Force
+	Applied []Migration
+	Pending []Migration
+}
+
+// Status reports the applied and pending migrations of src. It only reads, unlike the
+// migrate commands it doesn't create a missing version table.
+func Status(ctx context.Context, pool *pgxpool.Pool, src Source) (Report, error) {
+	list, err := src.Migrations()
+	if err != nil {
+		return Report{}, err
+	}
+	version, dirty, err := readVersion(ctx, pool, src.Table)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Source: src.Name, Table: src.Table, Version: version, Dirty: dirty}
+	for _, m := range list {
+		// a dirty version is recorded before its migration ran, it counts as applied
+		if m.Version <= version {
+			report.Applied = append(report.Applied, m)
+		} else {
+			report.Pending = append(report.Pending, m)
+		}
+	}
+	return report, nil
+}
+
+// CheckApplied fails when the database is dirty or behind the embedded migrations,
+// a newer version is fine while a rolling deploy replaces older replicas
+func CheckApplied(ctx context.Context, pool *pgxpool.Pool, src Source) error {
+	latest, err := src.Latest()
+	if err != nil {
+		return err
+	}
+	version, dirty, err := readVersion(ctx, pool, src.Table)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database is dirty at version %d", version)
+	}
+	if version < latest {
+		if version == 0 {
+			return fmt.Errorf("no migrations applied, want version %d", latest)
+		}
+		return fmt.Errorf("database is at version %d, want %d", version, latest)
+	}
+	return nil
+}
+
+// readVersion reads the version table golang-migrate maintains, 0 when it is empty or missing
+func readVersion(ctx context.Context, pool *pgxpool.Pool, table string) (version uint, dirty bool, err error) {
+	query := "SELECT version, dirty FROM " + pgx.Identifier{table}.Sanitize() + " LIMIT 1"
+	var v int64 // -1 when a migration from nothing failed
+	err = pool.QueryRow(ctx, query).Scan(&v, &dirty)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, false, nil
+	case errors.As(err, &pgErr) && pgErr.Code == "42P01": // undefined_table
+		return 0, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("read migration version: %w", err)
+	}
+	return uint(max(v, 0)), dirty, nil
+}
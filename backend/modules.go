@@ -0,0 +1,6 @@
+package main
+
+// Feature modules register themselves when imported, add a blank import to enable one
+import (
+	_ "github.com/anish-chanda/go-app-starter/internal/modules/hello"
+)